@@ -0,0 +1,53 @@
+package riblt
+
+import (
+	"crypto/subtle"
+)
+
+// Bytes is a source symbol that is a byte string, with XOR being the bitwise
+// exclusive-or operation. XOR modifies the receiver in place, processing a
+// machine word or more at a time, so it is fast for long byte strings. When
+// the operands have different lengths, the shorter one is treated as if it
+// were padded with zeros. Because Hash does not ignore trailing zeros, all
+// source symbols in a set should have the same length, e.g., by padding them
+// to the length of the longest one. The default value, nil, is the empty byte
+// string.
+type Bytes []byte
+
+// XOR implements Symbol. It modifies and returns the receiver, or a newly
+// allocated byte string if the receiver is shorter than b2.
+func (b Bytes) XOR(b2 Bytes) Bytes {
+	if len(b) < len(b2) {
+		// The capacity beyond len(b) may belong to a slice held by the
+		// caller, so we do not write into it.
+		nb := make(Bytes, len(b2))
+		copy(nb, b)
+		b = nb
+	}
+	subtle.XORBytes(b, b, b2)
+	return b
+}
+
+// Hash implements Symbol. It is SipHash-2-4 of b with a fixed key.
+func (b Bytes) Hash() uint64 {
+	return SipHash(defaultKey, b)
+}
+
+// Clone implements Cloner.
+func (b Bytes) Clone() Bytes {
+	if b == nil {
+		return nil
+	}
+	return append(Bytes{}, b...)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (b Bytes) MarshalBinary() ([]byte, error) {
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (b *Bytes) UnmarshalBinary(data []byte) error {
+	*b = append((*b)[:0], data...)
+	return nil
+}
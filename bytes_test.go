@@ -0,0 +1,154 @@
+package riblt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+func newTestBytes(i uint64, size int) Bytes {
+	b := make(Bytes, size)
+	for j := 0; j+8 <= size; j += 8 {
+		binary.LittleEndian.PutUint64(b[j:], i*uint64(j+1))
+	}
+	binary.LittleEndian.PutUint64(b[size-8:], i)
+	return b
+}
+
+func TestBytesXOR(t *testing.T) {
+	for _, n := range [][2]int{{0, 0}, {0, 5}, {5, 0}, {3, 17}, {100, 100}, {1000, 7}} {
+		b1 := make(Bytes, n[0])
+		b2 := make(Bytes, n[1])
+		for i := range b1 {
+			b1[i] = byte(i * 7)
+		}
+		for i := range b2 {
+			b2[i] = byte(i * 13)
+		}
+		// XOR into a receiver that has enough capacity, which must be left
+		// untouched past its length, as it may be held by the caller
+		backing := make(Bytes, max(n[0], n[1]))
+		for i := range backing {
+			backing[i] = 0xff
+		}
+		res := append(backing[:0], b1...).XOR(b2)
+		for i := len(b1); i < len(backing); i++ {
+			if backing[i] != 0xff {
+				t.Fatalf("XOR of %d and %d bytes wrote past the length of the receiver", n[0], n[1])
+			}
+		}
+		if len(res) != max(n[0], n[1]) {
+			t.Fatalf("XOR of %d and %d bytes has %d bytes", n[0], n[1], len(res))
+		}
+		for i := range res {
+			var exp byte
+			if i < len(b1) {
+				exp ^= b1[i]
+			}
+			if i < len(b2) {
+				exp ^= b2[i]
+			}
+			if res[i] != exp {
+				t.Fatalf("byte %d of XOR of %d and %d bytes is %d, expected %d", i, n[0], n[1], res[i], exp)
+			}
+		}
+	}
+}
+
+func TestBytesEncodeAndDecode(t *testing.T) {
+	enc := Encoder[Bytes]{}
+	dec := Decoder[Bytes]{}
+	for i := uint64(0); i < 1000; i++ {
+		enc.AddSymbol(newTestBytes(i, 100))
+		dec.AddSymbol(newTestBytes(i+50, 100))
+	}
+	for !dec.Decoded() || len(dec.Remote()) == 0 {
+		dec.AddCodedSymbol(enc.ProduceNextCodedSymbol())
+		dec.TryDecode()
+	}
+	if len(dec.Remote()) != 50 || len(dec.Local()) != 50 {
+		t.Fatalf("recovered %d remote and %d local symbols, expected 50 and 50", len(dec.Remote()), len(dec.Local()))
+	}
+	for _, s := range dec.Remote() {
+		i := binary.LittleEndian.Uint64(s.Symbol[92:])
+		if i >= 50 || string(s.Symbol) != string(newTestBytes(i, 100)) {
+			t.Errorf("recovered incorrect remote symbol %x", []byte(s.Symbol))
+		}
+	}
+
+	data, err := dec.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := Decoder[Bytes]{}
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if string(restored.Local()[0].Symbol) != string(dec.Local()[0].Symbol) {
+		t.Errorf("restored decoder differs")
+	}
+}
+
+var benchmarkBytesSizes = []int{8, 64, 256, 1024, 4096}
+
+func BenchmarkBytesXOR(bc *testing.B) {
+	for _, size := range benchmarkBytesSizes {
+		b1 := newTestBytes(1, size)
+		b2 := newTestBytes(2, size)
+		bc.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				b1 = b1.XOR(b2)
+			}
+		})
+		// byte-at-a-time baseline
+		bc.Run(fmt.Sprintf("size=%d/bytewise", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				for j := range b1 {
+					b1[j] ^= b2[j]
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkBytesEncode(bc *testing.B) {
+	for _, size := range benchmarkBytesSizes {
+		bc.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			enc := Encoder[Bytes]{}
+			for i := uint64(0); i < 1000; i++ {
+				enc.AddSymbol(newTestBytes(i, size))
+			}
+			// each coded symbol of a set of n source symbols has about
+			// 2*ln(n) source symbols mapped to it, so we report the
+			// throughput as the size of coded symbols produced
+			b.SetBytes(int64(size))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if i%10000 == 0 {
+					b.StopTimer()
+					enc.Reset()
+					for i := uint64(0); i < 1000; i++ {
+						enc.AddSymbol(newTestBytes(i, size))
+					}
+					b.StartTimer()
+				}
+				enc.ProduceNextCodedSymbol()
+			}
+		})
+	}
+}
+
+func BenchmarkBytesSketchAddSymbol(bc *testing.B) {
+	for _, size := range benchmarkBytesSizes {
+		bc.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			s := NewSketch[Bytes](1000)
+			t := newTestBytes(1, size)
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				s.AddSymbol(t)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package riblt
 import (
 	"encoding/binary"
 	"github.com/dchest/siphash"
+	"math/rand"
 	"testing"
 	"unsafe"
 )
@@ -24,6 +25,18 @@ func (d testSymbol) Hash() uint64 {
 	return siphash.Hash(567, 890, d[:])
 }
 
+func (d testSymbol) MarshalBinary() ([]byte, error) {
+	return d[:], nil
+}
+
+func (d *testSymbol) UnmarshalBinary(data []byte) error {
+	if len(data) != testSymbolSize {
+		return ErrMalformed
+	}
+	copy(d[:], data)
+	return nil
+}
+
 func newTestSymbol(i uint64) testSymbol {
 	data := testSymbol{}
 	binary.LittleEndian.PutUint64(data[0:8], i)
@@ -142,3 +155,247 @@ func TestEncodeAndDecode(t *testing.T) {
 	}
 }
 
+
+func TestAddCodedSymbols(t *testing.T) {
+	enc := Encoder[testSymbol]{}
+	ref := Decoder[testSymbol]{}
+	dec := Decoder[testSymbol]{}
+
+	var nextId uint64
+	for i := 0; i < 500; i++ {
+		s := newTestSymbol(nextId)
+		nextId += 1
+		ref.AddSymbol(s)
+		dec.AddSymbol(s)
+	}
+	for i := 0; i < 500; i++ {
+		s := newTestSymbol(nextId)
+		nextId += 1
+		enc.AddSymbol(s)
+	}
+	for i := 0; i < 1000; i++ {
+		s := newTestSymbol(nextId)
+		nextId += 1
+		enc.AddSymbol(s)
+		ref.AddSymbol(s)
+		dec.AddSymbol(s)
+	}
+
+	var cs []CodedSymbol[testSymbol]
+	for !ref.Decoded() || len(cs) == 0 {
+		c := enc.ProduceNextCodedSymbol()
+		cs = append(cs, c)
+		ref.AddCodedSymbol(c)
+		ref.TryDecode()
+	}
+	// pad the sequence so that the decoder has to stop in the middle of a
+	// batch
+	for i := 0; i < 100; i++ {
+		cs = append(cs, enc.ProduceNextCodedSymbol())
+	}
+
+	total := 0
+	done := false
+	for batch := 64; !done; batch *= 2 {
+		end := total + batch
+		if end > len(cs) {
+			end = len(cs)
+		}
+		var n int
+		n, done = dec.AddCodedSymbols(cs[total:end])
+		total += n
+		if !done && end == len(cs) {
+			t.Fatalf("decoder did not finish after %d coded symbols", total)
+		}
+	}
+	if total != len(cs)-100 {
+		t.Errorf("decoding finished after %d coded symbols, expected %d", total, len(cs)-100)
+	}
+	if len(dec.Remote()) != 500 || len(dec.Local()) != 500 {
+		t.Errorf("recovered %d remote and %d local symbols, expected 500 and 500", len(dec.Remote()), len(dec.Local()))
+	}
+}
+
+func TestAddCodedSymbolAt(t *testing.T) {
+	enc := Encoder[testSymbol]{}
+	dec := Decoder[testSymbol]{}
+	local := make(map[uint64]struct{})
+	remote := make(map[uint64]struct{})
+
+	var nextId uint64
+	for i := 0; i < 300; i++ {
+		s := newTestSymbol(nextId)
+		nextId += 1
+		dec.AddSymbol(s)
+		local[s.Hash()] = struct{}{}
+	}
+	for i := 0; i < 300; i++ {
+		s := newTestSymbol(nextId)
+		nextId += 1
+		enc.AddSymbol(s)
+		remote[s.Hash()] = struct{}{}
+	}
+	for i := 0; i < 1000; i++ {
+		s := newTestSymbol(nextId)
+		nextId += 1
+		enc.AddSymbol(s)
+		dec.AddSymbol(s)
+	}
+
+	// Simulate a lossy link that drops 20% of the coded symbols, duplicates
+	// 10%, and shuffles them in blocks of 16. Dropped coded symbols of the
+	// first block are delivered after 1000 coded symbols are sent.
+	rng := rand.New(rand.NewSource(1))
+	var late []int
+	delivered := 0
+	var cs []CodedSymbol[testSymbol]
+	for !dec.Decoded() || len(cs) < 1000 {
+		if len(cs) > 5000 {
+			t.Fatalf("decoder did not finish after %d coded symbols", len(cs))
+		}
+		for i := 0; i < 16; i++ {
+			cs = append(cs, enc.ProduceNextCodedSymbol())
+		}
+		block := rng.Perm(16)
+		for _, j := range block {
+			idx := len(cs) - 16 + j
+			if rng.Float64() < 0.2 {
+				if idx < 16 {
+					late = append(late, idx)
+				}
+				continue
+			}
+			dec.AddCodedSymbolAt(idx, cs[idx])
+			delivered += 1
+			if rng.Float64() < 0.1 {
+				dec.AddCodedSymbolAt(idx, cs[idx])
+			}
+		}
+		if len(cs) == 1000 {
+			for _, idx := range late {
+				dec.AddCodedSymbolAt(idx, cs[idx])
+				delivered += 1
+			}
+			// the decoder survives serialization with missing coded
+			// symbols
+			data, err := dec.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			dec = Decoder[testSymbol]{}
+			if err := dec.UnmarshalBinary(data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		dec.TryDecode()
+	}
+	if st := dec.Stats(); st.CodedSymbols != delivered || st.Missing == 0 {
+		t.Errorf("%d received and %d missing coded symbols, expected %d received", st.CodedSymbols, st.Missing, delivered)
+	}
+	for _, v := range dec.Remote() {
+		delete(remote, v.Hash)
+	}
+	for _, v := range dec.Local() {
+		delete(local, v.Hash)
+	}
+	if len(remote) != 0 || len(local) != 0 {
+		t.Errorf("missing symbols: %d remote and %d local", len(remote), len(local))
+	}
+	if len(dec.Remote()) != 300 || len(dec.Local()) != 300 {
+		t.Errorf("recovered %d remote and %d local symbols, expected 300 and 300", len(dec.Remote()), len(dec.Local()))
+	}
+}
+
+func TestAddCodedSymbolAtIBLTMapping(t *testing.T) {
+	// source symbols are not all mapped to coded symbol 0, so decoding is
+	// not done until every coded symbol is received
+	g := IBLTMapping{Cells: 300, K: 3}
+	enc := Encoder[testSymbol]{}
+	dec := Decoder[testSymbol]{}
+	enc.SetMapping(g)
+	dec.SetMapping(g)
+	for i := uint64(0); i < 100; i++ {
+		enc.AddSymbol(newTestSymbol(i))
+		if i >= 20 {
+			dec.AddSymbol(newTestSymbol(i))
+		}
+	}
+	var cs []CodedSymbol[testSymbol]
+	for i := 0; i < 300; i++ {
+		cs = append(cs, enc.ProduceNextCodedSymbol())
+	}
+	// the first coded symbol arrives first, and the others in reverse order
+	dec.AddCodedSymbolAt(0, cs[0])
+	for i := 299; i > 0; i-- {
+		dec.AddCodedSymbolAt(i, cs[i])
+		dec.TryDecode()
+		if i > 1 && dec.Decoded() {
+			t.Fatalf("decoder finished with %d coded symbols missing", i-1)
+		}
+	}
+	if !dec.Decoded() || len(dec.Remote()) != 20 {
+		t.Errorf("recovered %d remote symbols, expected 20", len(dec.Remote()))
+	}
+}
+
+func TestAddCodedSymbolAtNegative(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("negative index did not panic")
+		}
+	}()
+	dec := Decoder[testSymbol]{}
+	dec.AddCodedSymbolAt(-1, CodedSymbol[testSymbol]{})
+}
+
+func TestAddCodedSymbolsAt(t *testing.T) {
+	enc := Encoder[testSymbol]{}
+	dec := Decoder[testSymbol]{}
+	var nextId uint64
+	for i := 0; i < 300; i++ {
+		s := newTestSymbol(nextId)
+		nextId += 1
+		dec.AddSymbol(s)
+	}
+	for i := 0; i < 300; i++ {
+		s := newTestSymbol(nextId)
+		nextId += 1
+		enc.AddSymbol(s)
+	}
+	for i := 0; i < 1000; i++ {
+		s := newTestSymbol(nextId)
+		nextId += 1
+		enc.AddSymbol(s)
+		dec.AddSymbol(s)
+	}
+	var cs []CodedSymbol[testSymbol]
+	for i := 0; i < 3000; i++ {
+		cs = append(cs, enc.ProduceNextCodedSymbol())
+	}
+
+	// A batch far ahead of the others does not make the decoder finish,
+	// even if it recovers some source symbols, because source symbols mapped
+	// only to missing coded symbols would go unnoticed.
+	if _, done := dec.AddCodedSymbolsAt(1000, cs[1000:3000]); done || dec.Decoded() {
+		t.Fatalf("decoder finished without the first coded symbol")
+	}
+	// Batches of 100 arrive in reverse order in groups of 3, as if fetched
+	// from 3 sources in parallel.
+	done := false
+	for g := 0; g < 1000 && !done; g += 300 {
+		for k := 2; k >= 0 && !done; k-- {
+			from := g + k*100
+			end := min(from+100, 1000)
+			if from >= end {
+				continue
+			}
+			_, done = dec.AddCodedSymbolsAt(from, cs[from:end])
+		}
+	}
+	if !done || !dec.Decoded() {
+		t.Fatalf("decoder did not finish")
+	}
+	if len(dec.Remote()) != 300 || len(dec.Local()) != 300 {
+		t.Errorf("recovered %d remote and %d local symbols, expected 300 and 300", len(dec.Remote()), len(dec.Local()))
+	}
+}
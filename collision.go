@@ -0,0 +1,137 @@
+package riblt
+
+// Collision is a pair of source symbols of the same hash. Source symbols of
+// the same hash are mapped to the same coded symbols, so they are
+// indistinguishable to the Decoder: if both are in a set, they are either
+// cancelled out or recovered as the XOR of them; if one is in each set, they
+// cancel out each other, and neither is recovered.
+type Collision[T Symbol[T]] struct {
+	Hash   uint64
+	First  T // source symbol seen first
+	Second T // source symbol seen second
+}
+
+// CollisionDetector detects source symbols of the same hash in a set. Encoder
+// and Decoder use one when DetectCollisions is called. Since a Sketch holds no
+// state other than its coded symbols, source symbols are inserted to a Sketch
+// along with a CollisionDetector using Sketch.AddHashedSymbolChecked. A
+// SketchIndex needs none, as it refuses source symbols whose hashes are in the
+// set. Its zero value is an empty CollisionDetector ready to use.
+type CollisionDetector[T Symbol[T]] struct {
+	symbols    map[uint64]T // first source symbol seen of each hash
+	collisions []Collision[T]
+}
+
+// Add records source symbol s. It returns false and records a Collision if a
+// source symbol of the same hash has been recorded, which may be s itself.
+func (c *CollisionDetector[T]) Add(s HashedSymbol[T]) bool {
+	if first, ok := c.symbols[s.Hash]; ok {
+		c.collisions = append(c.collisions, Collision[T]{s.Hash, first, s.Symbol})
+		return false
+	}
+	if c.symbols == nil {
+		c.symbols = make(map[uint64]T)
+	}
+	c.symbols[s.Hash] = s.Symbol
+	return true
+}
+
+// check records a Collision if a source symbol of the same hash as s has
+// been recorded, without recording s.
+func (c *CollisionDetector[T]) check(s HashedSymbol[T]) {
+	if first, ok := c.symbols[s.Hash]; ok {
+		c.collisions = append(c.collisions, Collision[T]{s.Hash, first, s.Symbol})
+	}
+}
+
+// Collisions returns the collisions detected so far, in the order they were
+// detected.
+func (c *CollisionDetector[T]) Collisions() []Collision[T] {
+	return c.collisions
+}
+
+// Reset clears c.
+func (c *CollisionDetector[T]) Reset() {
+	clear(c.symbols)
+	if len(c.collisions) != 0 {
+		c.collisions = c.collisions[:0]
+	}
+}
+
+// DetectCollisions makes e record source symbols added to it whose hashes
+// collide with the ones added before. See Collisions. Such source symbols are
+// still added, so that the set is what the caller expects, but decoding is
+// likely to give a wrong result, and the caller should rehash the set, e.g.,
+// using a different key, instead. Detection takes an additional map from
+// hashes to source symbols. It is undefined behavior to call DetectCollisions
+// after calling AddSymbol or AddHashedSymbol. Reset keeps detection enabled.
+func (e *Encoder[T]) DetectCollisions() {
+	e.detector = &CollisionDetector[T]{}
+}
+
+// Collisions returns the collisions among the source symbols added to e, or
+// nil if DetectCollisions has not been called.
+func (e *Encoder[T]) Collisions() []Collision[T] {
+	if e.detector == nil {
+		return nil
+	}
+	return e.detector.Collisions()
+}
+
+// DetectCollisions makes d record source symbols added to B whose hashes
+// collide with the ones added before, like Encoder.DetectCollisions. In
+// addition, d records source symbols recovered as exclusive to A whose hashes
+// collide with source symbols in B, in which case Second is the source symbol
+// recovered. It cannot happen unless A has a source symbol that collides with
+// one in B, or d recovered a wrong source symbol. Only the source symbols
+// added by AddSymbol and AddHashedSymbol are checked, not the ones taken from
+// the local source. d also detects coded symbols that mix source symbols of
+// the same hash, one exclusive to A and one to B, see Conflicts. It is
+// undefined behavior to call DetectCollisions after calling AddSymbol or
+// AddHashedSymbol. Reset keeps detection enabled.
+func (d *Decoder[T]) DetectCollisions() {
+	d.window.detector = &CollisionDetector[T]{}
+}
+
+// Collisions returns the collisions detected by d, or nil if DetectCollisions
+// has not been called.
+func (d *Decoder[T]) Collisions() []Collision[T] {
+	if d.window.detector == nil {
+		return nil
+	}
+	return d.window.detector.Collisions()
+}
+
+// Conflicts returns the sums of the coded symbols that d decoded as empty,
+// i.e., of count 0 and hash 0, but whose sums of source symbols are not e,
+// the identity element. Such a coded symbol mixes source symbols whose hashes
+// cancel out, typically a source symbol exclusive to A and one exclusive to B
+// of the same hash, and its sum is their XOR. Neither source symbol can be
+// recovered, so the difference recovered by d is incomplete, and the caller
+// should rehash the sets. Without DetectCollisions, d decodes such coded
+// symbols as empty, or never finishes decoding, and Conflicts returns nil.
+func (d *Decoder[T]) Conflicts() []T {
+	return d.conflicts
+}
+
+// findConflicts rebuilds the list of conflicts from the coded symbols visited,
+// e.g., after deserializing d. Coded symbols decoded as pure are peeled off
+// the source symbols they hold, so they are empty once visited.
+func (d *Decoder[T]) findConflicts() {
+	d.conflicts = nil
+	for i, c := range d.cs {
+		if d.visited[i] && c.Count == 0 && c.Hash == 0 && !isIdentity(c.Symbol) {
+			d.conflicts = append(d.conflicts, cloneSymbol(c.Symbol))
+		}
+	}
+}
+
+// isIdentity returns whether s is e, the identity element, with high
+// probability. It compares the hash of s with the one of s XOR s, which is e
+// in the shape of s, e.g., a byte string of zeros of the same length for
+// Bytes, whose hash differs from the one of the empty byte string.
+func isIdentity[T Symbol[T]](s T) bool {
+	e := cloneSymbol(s)
+	e = e.XOR(s)
+	return s.Hash() == e.Hash()
+}
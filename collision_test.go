@@ -0,0 +1,176 @@
+package riblt
+
+import (
+	"testing"
+)
+
+func TestCollisionDetector(t *testing.T) {
+	c := CollisionDetector[testSymbol]{}
+	a := newTestSymbol(1)
+	b := newTestSymbol(2)
+	if !c.Add(HashedSymbol[testSymbol]{a, 42}) {
+		t.Errorf("first source symbol reported as colliding")
+	}
+	if c.Add(HashedSymbol[testSymbol]{b, 42}) {
+		t.Errorf("colliding source symbol not reported")
+	}
+	if !c.Add(HashedSymbol[testSymbol]{b, 43}) {
+		t.Errorf("source symbol of a new hash reported as colliding")
+	}
+	want := []Collision[testSymbol]{{42, a, b}}
+	if got := c.Collisions(); len(got) != 1 || got[0] != want[0] {
+		t.Errorf("got collisions %v, expected %v", got, want)
+	}
+	c.Reset()
+	if len(c.Collisions()) != 0 || !c.Add(HashedSymbol[testSymbol]{b, 42}) {
+		t.Errorf("collisions kept after reset")
+	}
+}
+
+func TestDetectCollisions(t *testing.T) {
+	// A has two distinct source symbols of the same hash, x and y, and B
+	// has x, so y is recovered as exclusive to A.
+	x := newTestSymbol(1)
+	y := newTestSymbol(2)
+	h := y.Hash()
+	enc := Encoder[testSymbol]{}
+	dec := Decoder[testSymbol]{}
+	enc.DetectCollisions()
+	dec.DetectCollisions()
+	enc.AddHashedSymbol(HashedSymbol[testSymbol]{x, h})
+	enc.AddHashedSymbol(HashedSymbol[testSymbol]{y, h})
+	dec.AddHashedSymbol(HashedSymbol[testSymbol]{x, h})
+	for i := uint64(100); i < 200; i++ {
+		enc.AddSymbol(newTestSymbol(i))
+		dec.AddSymbol(newTestSymbol(i))
+	}
+	for i := uint64(200); i < 210; i++ {
+		enc.AddSymbol(newTestSymbol(i))
+	}
+	want := Collision[testSymbol]{h, x, y}
+	if got := enc.Collisions(); len(got) != 1 || got[0] != want {
+		t.Errorf("encoder detected %d collisions, expected 1", len(got))
+	}
+	if len(dec.Collisions()) != 0 {
+		t.Errorf("decoder detected collisions in a set without any")
+	}
+
+	for {
+		dec.AddCodedSymbol(enc.ProduceNextCodedSymbol())
+		dec.TryDecode()
+		if dec.Decoded() {
+			break
+		}
+	}
+	if got := dec.Collisions(); len(got) != 1 || got[0] != want {
+		t.Fatalf("decoder detected %d collisions, expected 1", len(got))
+	}
+	// collisions are detected again after serialization
+	data, err := dec.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec2 := Decoder[testSymbol]{}
+	dec2.DetectCollisions()
+	if err := dec2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if got := dec2.Collisions(); len(got) != 1 || got[0] != want {
+		t.Errorf("decoder detected %d collisions after serialization, expected 1", len(got))
+	}
+
+	enc.Reset()
+	enc.AddHashedSymbol(HashedSymbol[testSymbol]{x, h})
+	enc.AddHashedSymbol(HashedSymbol[testSymbol]{x, h})
+	if got := enc.Collisions(); len(got) != 1 || got[0] != (Collision[testSymbol]{h, x, x}) {
+		t.Errorf("duplicate source symbol not detected after reset")
+	}
+}
+
+func TestSketchCollisions(t *testing.T) {
+	x := newTestSymbol(1)
+	y := newTestSymbol(2)
+	h := x.Hash()
+
+	c := CollisionDetector[testSymbol]{}
+	s := NewSketch[testSymbol](10)
+	if !s.AddHashedSymbolChecked(HashedSymbol[testSymbol]{x, h}, nil, &c) {
+		t.Errorf("first source symbol reported as colliding")
+	}
+	if s.AddHashedSymbolChecked(HashedSymbol[testSymbol]{y, h}, nil, &c) {
+		t.Errorf("colliding source symbol not reported")
+	}
+	if s[0].Count != 2 {
+		t.Errorf("colliding source symbol not inserted")
+	}
+	want := Collision[testSymbol]{h, x, y}
+	if got := c.Collisions(); len(got) != 1 || got[0] != want {
+		t.Errorf("detected %d collisions, expected 1", len(got))
+	}
+
+	idx := NewSketchIndex[testSymbol](10, nil)
+	if !idx.AddHashedSymbol(HashedSymbol[testSymbol]{x, h}) {
+		t.Errorf("first source symbol refused")
+	}
+	if idx.AddHashedSymbol(HashedSymbol[testSymbol]{y, h}) {
+		t.Errorf("colliding source symbol not reported")
+	}
+	if idx.Len() != 1 {
+		t.Errorf("index holds %d source symbols, expected 1", idx.Len())
+	}
+}
+
+func TestDetectConflicts(t *testing.T) {
+	// A has x and B has y, distinct source symbols of the same hash, so
+	// they cancel out in every coded symbol.
+	x := newTestSymbol(1)
+	y := newTestSymbol(2)
+	h := y.Hash()
+	for _, extra := range []uint64{0, 10} {
+		enc := Encoder[testSymbol]{}
+		dec := Decoder[testSymbol]{}
+		dec.DetectCollisions()
+		enc.AddHashedSymbol(HashedSymbol[testSymbol]{x, h})
+		dec.AddHashedSymbol(HashedSymbol[testSymbol]{y, h})
+		for i := uint64(100); i < 200; i++ {
+			enc.AddSymbol(newTestSymbol(i))
+			dec.AddSymbol(newTestSymbol(i))
+		}
+		// with other source symbols in the difference, coded symbols
+		// mixing x and y are only peeled to degree 0 after recovering them
+		for i := uint64(200); i < 200+extra; i++ {
+			enc.AddSymbol(newTestSymbol(i))
+		}
+		for n := 0; !dec.Decoded() || n == 0; n++ {
+			if n > 1000 {
+				t.Fatalf("%d extra source symbols: decoder did not finish", extra)
+			}
+			dec.AddCodedSymbol(enc.ProduceNextCodedSymbol())
+			dec.TryDecode()
+		}
+		if len(dec.Remote()) != int(extra) {
+			t.Errorf("%d extra source symbols: recovered %d remote symbols", extra, len(dec.Remote()))
+		}
+		if c := dec.Conflicts(); len(c) == 0 || c[0] != x.XOR(y) {
+			t.Errorf("%d extra source symbols: detected %d conflicts, expected the XOR of x and y", extra, len(c))
+		}
+		// conflicts are detected again after serialization
+		data, err := dec.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec2 := Decoder[testSymbol]{}
+		dec2.DetectCollisions()
+		if err := dec2.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if len(dec2.Conflicts()) != len(dec.Conflicts()) {
+			t.Errorf("%d extra source symbols: detected %d conflicts after serialization, expected %d", extra, len(dec2.Conflicts()), len(dec.Conflicts()))
+		}
+	}
+
+	// an empty Bytes coded symbol of a non-zero length is not a conflict
+	if !isIdentity(Bytes{0, 0, 0}) || isIdentity(Bytes{0, 1, 0}) {
+		t.Errorf("isIdentity wrong on byte strings")
+	}
+}
@@ -9,32 +9,74 @@ type Decoder[T Symbol[T]] struct {
 	local codingWindow[T]
 	// set of source symbols that the decoder initially has
 	window codingWindow[T]
+	// coded symbol sequence of source symbols that the decoder initially
+	// has, in addition to window
+	source CodedSymbolSource[T]
 	// set of source symbols that are exclusive to the encoder
 	remote codingWindow[T]
 	// indices of coded symbols that can be decoded, i.e., degree equal to -1
 	// or 1 and sum of hash equal to hash of sum, or degree equal to 0 and sum
 	// of hash equal to 0
 	decodable []int
+	// whether each coded symbol has been visited in the decodable list and
+	// decoded
+	visited []bool
+	// whether each coded symbol is missing, i.e., its index was skipped by
+	// AddCodedSymbolAt and it has not been received since, in which case cs
+	// holds the contributions to it of the source symbols known to d
+	missing []bool
+	// number of missing coded symbols
+	nmissing int
 	// number of coded symbols that are decoded
 	decoded int
+	// number of times a recovered source symbol is peeled off a coded symbol
+	peels int
+	// sums of coded symbols decoded as empty that are not empty, see
+	// Conflicts
+	conflicts []T
+	// mapping of source symbols to coded symbols, nil for RandomMapping
+	mapping Mapping
 }
 
 // Decoded returns true if and only if every existing coded symbols d received
-// so far have been decoded.
+// so far have been decoded. When coded symbols are passed out of order using
+// AddCodedSymbolAt, it also requires that no source symbol in the difference
+// goes unnoticed because it is only mapped to missing coded symbols. Under
+// RandomMapping and AlphaMapping, every source symbol is mapped to the first
+// coded symbol, so it suffices that the first coded symbol is received. Under
+// other Mappings, it requires every skipped coded symbol to be received.
 func (d *Decoder[T]) Decoded() bool {
-	return d.decoded == len(d.cs)
+	if d.decoded != len(d.cs)-d.nmissing {
+		return false
+	}
+	return d.nmissing == 0 || mapsAllToFirst(d.mapping) && !d.missing[0]
 }
 
 // Local returns the list of source symbols that are present in B but not in A.
+// The list is held by d, which keeps peeling the source symbols in it off
+// coded symbols received later, so the caller must not modify it, or the
+// source symbols in it when T is a pointer type; clone them instead.
 func (d *Decoder[T]) Local() []HashedSymbol[T] {
 	return d.local.symbols
 }
 
 // Remote returns the list of source symbols that are present in A but not in B.
+// Like the list returned by Local, it must not be modified.
 func (d *Decoder[T]) Remote() []HashedSymbol[T] {
 	return d.remote.symbols
 }
 
+// SetMapping sets the Mapping of source symbols to coded symbols used by d,
+// which must be the same as the one used by A's Encoder. A nil g stands for
+// RandomMapping, the default. It is undefined behavior to call SetMapping
+// after calling AddSymbol, AddHashedSymbol, or AddCodedSymbol.
+func (d *Decoder[T]) SetMapping(g Mapping) {
+	d.mapping = g
+	d.local.mapping = g
+	d.window.mapping = g
+	d.remote.mapping = g
+}
+
 // AddSymbol adds a source symbol to B, the Decoder's local set. It is
 // undefined behavior to call AddSymbol after AddCodedSymbol has been called
 // one or multiple times.
@@ -50,30 +92,150 @@ func (d *Decoder[T]) AddHashedSymbol(s HashedSymbol[T]) {
 	d.window.addHashedSymbol(s)
 }
 
+// SetLocalSource makes d take the coded symbols of B, the local set, from
+// src, in addition to the source symbols added by AddSymbol and
+// AddHashedSymbol. d takes the next coded symbol from src every time it
+// receives a coded symbol from A, so src must not have produced any coded
+// symbol. It allows B to be held by a DiskEncoder, or to be precomputed as a
+// Sketch or a SketchIndex, in which case decoding takes time independent of
+// the size of B. A Sketch limits the number of coded symbols d can receive to
+// its length, beyond which decoding results are invalid. See Sketch.Source
+// and SketchIndex.Source. It is undefined behavior to call SetLocalSource
+// after AddCodedSymbol has been called one or multiple times. Reset removes
+// the local source.
+func (d *Decoder[T]) SetLocalSource(src CodedSymbolSource[T]) {
+	d.source = src
+}
+
 // AddCodedSymbol passes the next coded symbol in A's sequence to the Decoder.
 // Coded symbols must be passed in the same ordering as they are generated by
-// A's Encoder.
+// A's Encoder. When mixed with AddCodedSymbolAt, the next coded symbol is the
+// one after the coded symbol of the highest index passed so far.
 func (d *Decoder[T]) AddCodedSymbol(c CodedSymbol[T]) {
+	d.AddCodedSymbolAt(len(d.cs), c)
+}
+
+// AddCodedSymbolAt passes the coded symbol of index i in A's sequence to the
+// Decoder. Unlike AddCodedSymbol, coded symbols may be passed in any order,
+// and some may never be passed, e.g., when they are lost in transit over an
+// unreliable transport. Coded symbols of the indices skipped so far are
+// treated as unknown until they are passed. Passing the coded symbol of an
+// index again has no effect.
+//
+// Decoded and TryDecode only consider the coded symbols received. Losing a
+// coded symbol costs about as much as not receiving it at all, so decoding
+// needs about as many coded symbols as it would over a reliable transport,
+// plus the ones lost. The Decoder allocates memory for every index up to i,
+// so i must be bounded by the caller. It panics if i is negative.
+func (d *Decoder[T]) AddCodedSymbolAt(i int, c CodedSymbol[T]) {
+	if i < 0 {
+		panic("negative coded symbol index")
+	}
+	if i < len(d.cs) && !d.missing[i] {
+		return
+	}
+	// c is modified in place below, so make sure that it does not share
+	// memory with the caller's copy
+	if isCloner[T]() {
+		c.Symbol = cloneSymbol(c.Symbol)
+	}
+	for len(d.cs) < i {
+		d.extend(emptyCodedSymbol[T](), true)
+	}
+	if i == len(d.cs) {
+		d.extend(c, false)
+	} else {
+		// the missing coded symbol holds the contributions of the source
+		// symbols known to d, as if it were received as an empty coded
+		// symbol, so adding c gives the coded symbol we would have had if c
+		// were received in order
+		d.cs[i] = d.cs[i].merge(c)
+		d.missing[i] = false
+		d.nmissing -= 1
+	}
+	// check if the coded symbol is decodable, and insert into decodable list if so
+	c = d.cs[i]
+	if (c.Count == 1 || c.Count == -1) && (c.Hash == c.Symbol.Hash()) {
+		d.decodable = append(d.decodable, i)
+	} else if c.Count == 0 && c.Hash == 0 {
+		d.decodable = append(d.decodable, i)
+	}
+}
+
+// extend appends coded symbol c to d, which is marked as missing if missing is
+// true.
+func (d *Decoder[T]) extend(c CodedSymbol[T], missing bool) {
+	if d.source != nil {
+		c = c.subtract(d.source.ProduceNextCodedSymbol())
+	}
 	// scan through decoded symbols to peel off matching ones
 	c = d.window.applyWindow(c, remove)
 	c = d.remote.applyWindow(c, remove)
 	c = d.local.applyWindow(c, add)
 	// insert the new coded symbol
 	d.cs = append(d.cs, c)
-	// check if the coded symbol is decodable, and insert into decodable list if so
-	if (c.Count == 1 || c.Count == -1) && (c.Hash == c.Symbol.Hash()) {
-		d.decodable = append(d.decodable, len(d.cs)-1)
-	} else if c.Count == 0 && c.Hash == 0 {
-		d.decodable = append(d.decodable, len(d.cs)-1)
+	d.visited = append(d.visited, false)
+	d.missing = append(d.missing, missing)
+	if missing {
+		d.nmissing += 1
+	}
+}
+
+// AddCodedSymbols passes a batch of coded symbols, continuing A's sequence, to
+// the Decoder and decodes them. It stops as soon as every coded symbol
+// received so far has been decoded, in which case done is true and the
+// remaining coded symbols in the batch are not consumed. n is the number of
+// coded symbols consumed from cs. When done is true, cs[:n] is the shortest
+// prefix of the batch after which decoding completes, so the encoder may be
+// told to stop after that many symbols.
+//
+// It is equivalent to calling AddCodedSymbol and TryDecode on each coded
+// symbol and checking Decoded, and costs the same, as TryDecode does nothing
+// unless a coded symbol is decodable. Peeling after each coded symbol is what
+// makes n exact.
+func (d *Decoder[T]) AddCodedSymbols(cs []CodedSymbol[T]) (n int, done bool) {
+	for n < len(cs) {
+		d.AddCodedSymbol(cs[n])
+		n += 1
+		// Peeling can only make progress if some coded symbol is decodable,
+		// and the decoder can only become decoded after peeling, or when
+		// the new coded symbol is already decoded on arrival, which also
+		// puts it into the decodable list.
+		if len(d.decodable) != 0 {
+			d.TryDecode()
+			if d.Decoded() {
+				return n, true
+			}
+		}
+	}
+	return n, false
+}
+
+// AddCodedSymbolsAt is like AddCodedSymbols, but passes cs[j] as the coded
+// symbol of index from+j in A's sequence, like AddCodedSymbolAt. Batches may
+// be passed in any order, e.g., when they are fetched from several sources in
+// parallel. It stops as soon as d is decoded, in which case done is true and
+// n is the number of coded symbols consumed from cs.
+func (d *Decoder[T]) AddCodedSymbolsAt(from int, cs []CodedSymbol[T]) (n int, done bool) {
+	for n < len(cs) {
+		d.AddCodedSymbolAt(from+n, cs[n])
+		n += 1
+		if len(d.decodable) != 0 {
+			d.TryDecode()
+			if d.Decoded() {
+				return n, true
+			}
+		}
 	}
-	return
+	return n, false
 }
 
 func (d *Decoder[T]) applyNewSymbol(t HashedSymbol[T], direction int64) randomMapping {
-	m := randomMapping{t.Hash, 0}
+	m := newMapping(d.mapping, t.Hash)
 	for int(m.lastIdx) < len(d.cs) {
 		cidx := int(m.lastIdx)
 		d.cs[cidx] = d.cs[cidx].apply(t, direction)
+		d.peels += 1
 		// Check if the coded symbol is now decodable. We do not want to insert
 		// a decodable symbol into the list if we already did, otherwise we
 		// will visit the same coded symbol twice. To see how we achieve that,
@@ -93,10 +255,20 @@ func (d *Decoder[T]) applyNewSymbol(t HashedSymbol[T], direction int64) randomMa
 		// duplicates. On the other hand, it is fine that we insert all
 		// degree-1 or -1 decodable symbols, because we only see them in such
 		// state once.
-		if (d.cs[cidx].Count == -1 || d.cs[cidx].Count == 1) && d.cs[cidx].Hash == d.cs[cidx].Symbol.Hash() {
+		//
+		// Missing coded symbols are checked when they are received instead.
+		//
+		// The exception is a coded symbol mixing source symbols of the same
+		// hash, one exclusive to each set, which reaches degree 0 without
+		// being decodable before. To detect it, we insert degree-0 symbols
+		// not yet visited when detecting collisions, and TryDecode skips the
+		// duplicates.
+		if !d.missing[cidx] && (d.cs[cidx].Count == -1 || d.cs[cidx].Count == 1) && d.cs[cidx].Hash == d.cs[cidx].Symbol.Hash() {
+			d.decodable = append(d.decodable, cidx)
+		} else if d.window.detector != nil && !d.missing[cidx] && !d.visited[cidx] && d.cs[cidx].Count == 0 && d.cs[cidx].Hash == 0 {
 			d.decodable = append(d.decodable, cidx)
 		}
-		m.nextIndex()
+		m.next(d.mapping)
 	}
 	return m
 }
@@ -113,37 +285,50 @@ func (d *Decoder[T]) TryDecode() {
 		// additional source symbols have been peeled off a coded symbol after
 		// it was inserted into the decodable list and before we visit them
 		// here.
+		//
+		// The invariant only holds if the coded symbols are consistent with
+		// the local set, i.e., produced by an Encoder of a set that differs
+		// from the local set only by the source symbols being recovered. To
+		// make sure that decoding terminates and does not panic on arbitrary
+		// input, we visit each coded symbol at most once, and skip coded
+		// symbols whose degree is no longer -1, 0, or 1. Neither happens
+		// with consistent input, where each coded symbol is decoded once.
+		if d.visited[cidx] {
+			continue
+		}
 		switch c.Count {
 		case 1:
-			// allocate a symbol and then XOR with the sum, so that we are
-			// guaranted to copy the sum whether or not the symbol interface is
-			// implemented as a pointer
-			ns := HashedSymbol[T]{}
-			ns.Symbol = ns.Symbol.XOR(c.Symbol)
-			ns.Hash = c.Hash
+			// copy the sum, so that the recovered symbol does not share
+			// memory with the coded symbol, which is modified later
+			ns := HashedSymbol[T]{cloneSymbol(c.Symbol), c.Hash}
 			m := d.applyNewSymbol(ns, remove)
 			d.remote.addHashedSymbolWithMapping(ns, m)
+			if d.window.detector != nil {
+				d.window.detector.check(ns)
+			}
 			d.decoded += 1
 		case -1:
-			ns := HashedSymbol[T]{}
-			ns.Symbol = ns.Symbol.XOR(c.Symbol)
-			ns.Hash = c.Hash
+			ns := HashedSymbol[T]{cloneSymbol(c.Symbol), c.Hash}
 			m := d.applyNewSymbol(ns, add)
 			d.local.addHashedSymbolWithMapping(ns, m)
 			d.decoded += 1
 		case 0:
+			if d.window.detector != nil && !isIdentity(c.Symbol) {
+				d.conflicts = append(d.conflicts, cloneSymbol(c.Symbol))
+			}
 			d.decoded += 1
 		default:
-			// a decodable symbol does not turn undecodable, so its degree must
-			// be -1, 0, or 1
-			panic("invalid degree for decodable coded symbol")
+			// a decodable symbol does not turn undecodable given consistent
+			// input, so its degree must be -1, 0, or 1
+			continue
 		}
+		d.visited[cidx] = true
 	}
 	d.decodable = d.decodable[:0]
 }
 
-// Reset clears d. It is more efficient to call Reset to reuse an existing
-// Decoder than creating a new one.
+// Reset clears d, but keeps its Mapping. It is more efficient to call Reset to
+// reuse an existing Decoder than creating a new one.
 func (d *Decoder[T]) Reset() {
 	if len(d.cs) != 0 {
 		d.cs = d.cs[:0]
@@ -151,8 +336,18 @@ func (d *Decoder[T]) Reset() {
 	if len(d.decodable) != 0 {
 		d.decodable = d.decodable[:0]
 	}
+	if len(d.visited) != 0 {
+		d.visited = d.visited[:0]
+	}
+	if len(d.missing) != 0 {
+		d.missing = d.missing[:0]
+	}
 	d.local.reset()
 	d.remote.reset()
 	d.window.reset()
+	d.source = nil
 	d.decoded = 0
+	d.nmissing = 0
+	d.peels = 0
+	d.conflicts = nil
 }
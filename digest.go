@@ -0,0 +1,103 @@
+package riblt
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"sync"
+)
+
+// ErrNotFound is returned by a Store when it does not have the requested
+// payload.
+var ErrNotFound = errors.New("riblt: payload not found")
+
+// Digest is a source symbol that is the SHA-256 digest of a payload, such as
+// a large record. Reconciling digests instead of the payloads themselves keeps
+// coded symbols small, after which the missing payloads can be requested by
+// their digests. See ServeDigests and SyncDigests.
+type Digest [32]byte
+
+// DigestOf returns the Digest of payload data.
+func DigestOf(data []byte) Digest {
+	return sha256.Sum256(data)
+}
+
+// XOR implements Symbol.
+func (d Digest) XOR(d2 Digest) Digest {
+	subtle.XORBytes(d[:], d[:], d2[:])
+	return d
+}
+
+// Hash implements Symbol. It is SipHash-2-4 of d with a fixed key. Although d
+// is already uniformly random, taking part of d as the hash would make Hash
+// homomorphic over XOR.
+func (d Digest) Hash() uint64 {
+	return SipHash(defaultKey, d[:])
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (d Digest) MarshalBinary() ([]byte, error) {
+	return d[:], nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (d *Digest) UnmarshalBinary(data []byte) error {
+	if len(data) != len(d) {
+		return ErrMalformed
+	}
+	copy(d[:], data)
+	return nil
+}
+
+// Store holds payloads by their digests.
+type Store interface {
+	// Get returns the payload of digest d, or ErrNotFound if there is no
+	// such payload.
+	Get(d Digest) ([]byte, error)
+	// Put stores payload data, whose digest is d.
+	Put(d Digest, data []byte) error
+}
+
+// MapStore is a Store that holds payloads in memory. Its zero value is an
+// empty store ready to use. It is safe for concurrent use.
+type MapStore struct {
+	mu       sync.RWMutex
+	payloads map[Digest][]byte
+}
+
+// Get implements Store.
+func (s *MapStore) Get(d Digest) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.payloads[d]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+// Put implements Store. It keeps data, so data must not be modified
+// afterwards.
+func (s *MapStore) Put(d Digest, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.payloads == nil {
+		s.payloads = make(map[Digest][]byte)
+	}
+	s.payloads[d] = data
+	return nil
+}
+
+// Add stores payload data and returns its digest.
+func (s *MapStore) Add(data []byte) Digest {
+	d := DigestOf(data)
+	s.Put(d, data)
+	return d
+}
+
+// Len returns the number of payloads in s.
+func (s *MapStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.payloads)
+}
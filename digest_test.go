@@ -0,0 +1,31 @@
+package riblt
+
+import (
+	"testing"
+)
+
+func TestDigestHash(t *testing.T) {
+	a := DigestOf([]byte("a"))
+	b := DigestOf([]byte("b"))
+	if a.XOR(b).Hash() == a.Hash()^b.Hash() {
+		t.Errorf("hash of digests is homomorphic")
+	}
+	if a.XOR(b).XOR(b) != a {
+		t.Errorf("XOR is not its own inverse")
+	}
+}
+
+func TestMapStore(t *testing.T) {
+	s := MapStore{}
+	if _, err := s.Get(DigestOf(nil)); err != ErrNotFound {
+		t.Errorf("got error %v from an empty store, expected ErrNotFound", err)
+	}
+	d := s.Add([]byte("hello"))
+	data, err := s.Get(d)
+	if err != nil || string(data) != "hello" {
+		t.Errorf("got %q, %v, expected hello", data, err)
+	}
+	if s.Len() != 1 {
+		t.Errorf("store has %d payloads, expected 1", s.Len())
+	}
+}
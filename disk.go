@@ -0,0 +1,245 @@
+package riblt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+)
+
+// DiskEncoder is an Encoder that keeps the source symbols and their mapping
+// states in files instead of memory, so that it can encode sets that do not
+// fit in memory. It produces coded symbols in chunks of a fixed length. The
+// source symbols are kept in buckets according to the chunk that contains the
+// next coded symbol they are mapped to, and producing a chunk reads its
+// bucket and appends each source symbol to the bucket of its next chunk, all
+// with sequential I/O. Only the coded symbols of one chunk are kept in memory.
+// Buckets are kept for a block of diskBuckets chunks at a time. Like the
+// priority queue of Encoder, source symbols mapped to later blocks are kept in
+// order of their next coded symbols, though only roughly: they are kept in far
+// buckets as in a radix heap, by the highest bit in which their block differs
+// from the current one. When moving to the next block, only the far bucket of
+// the highest bit that changes is redistributed, so each source symbol is
+// redistributed a number of times logarithmic in the distance to its next
+// chunk, instead of linear.
+//
+// Serializing source symbols requires T to implement
+// encoding.BinaryMarshaler and *T to implement encoding.BinaryUnmarshaler.
+// It is the same set of requirements as Encoder.MarshalBinary.
+type DiskEncoder[T Symbol[T]] struct {
+	dir     string
+	mapping Mapping
+	chunk   int              // number of coded symbols in a chunk
+	buf     []CodedSymbol[T] // coded symbols of the current chunk
+	pos     int              // index in buf of the next coded symbol to return
+	nextIdx int              // index of the first coded symbol of the next chunk
+	base    int              // the chunk that buckets[0] holds
+	buckets [diskBuckets]diskBucket
+	// far[k] holds source symbols mapped to blocks whose highest bit that
+	// differs from the current block is bit k
+	far    [64]diskBucket
+	record []byte // reusable buffer for serializing a source symbol
+	err    error  // the first error encountered
+}
+
+// number of chunks for which source symbols are kept in separate buckets
+const diskBuckets = 16
+
+// diskBucket is a file of serialized source symbols and their mapping states.
+// The file is created at the first write.
+type diskBucket struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+// NewDiskEncoder returns an empty DiskEncoder that keeps its files in
+// directory dir and produces coded symbols in chunks of the given length.
+// Call Close to remove the files once the DiskEncoder is no longer needed.
+func NewDiskEncoder[T Symbol[T]](dir string, chunk int) *DiskEncoder[T] {
+	if chunk <= 0 {
+		panic("invalid chunk length")
+	}
+	return &DiskEncoder[T]{dir: dir, chunk: chunk}
+}
+
+// SetMapping sets the Mapping of source symbols to coded symbols used by e. It
+// is the same as Encoder.SetMapping.
+func (e *DiskEncoder[T]) SetMapping(g Mapping) {
+	e.mapping = g
+}
+
+// AddSymbol adds source symbol s to e. It is undefined behavior to call
+// AddSymbol after calling ProduceNextCodedSymbol.
+func (e *DiskEncoder[T]) AddSymbol(s T) {
+	e.AddHashedSymbol(HashedSymbol[T]{s, s.Hash()})
+}
+
+// AddHashedSymbol adds source symbol s to e. It is undefined behavior to call
+// AddHashedSymbol after calling ProduceNextCodedSymbol.
+func (e *DiskEncoder[T]) AddHashedSymbol(s HashedSymbol[T]) {
+	e.store(s, newMapping(e.mapping, s.Hash))
+}
+
+// ProduceNextCodedSymbol returns the next coded symbol in the sequence. If an
+// I/O error happens, the returned coded symbol and all coded symbols after it
+// are invalid, and Err returns the error.
+func (e *DiskEncoder[T]) ProduceNextCodedSymbol() CodedSymbol[T] {
+	if e.pos == len(e.buf) {
+		e.produceChunk()
+	}
+	e.pos += 1
+	return e.buf[e.pos-1]
+}
+
+// Err returns the first error that e has encountered.
+func (e *DiskEncoder[T]) Err() error {
+	return e.err
+}
+
+// Close removes the files of e. e must not be used afterwards.
+func (e *DiskEncoder[T]) Close() error {
+	var err error
+	for _, b := range append(e.buckets[:], e.far[:]...) {
+		if rerr := b.remove(); err == nil {
+			err = rerr
+		}
+	}
+	e.buckets = [diskBuckets]diskBucket{}
+	e.far = [64]diskBucket{}
+	return err
+}
+
+// store appends source symbol s, whose next coded symbol is m.lastIdx, to the
+// bucket of the chunk that contains the coded symbol.
+func (e *DiskEncoder[T]) store(s HashedSymbol[T], m randomMapping) {
+	if e.err != nil || m.lastIdx == math.MaxInt64 {
+		// the mapping has ended
+		return
+	}
+	c := int(m.lastIdx / uint64(e.chunk))
+	var b *diskBucket
+	if c-e.base < diskBuckets {
+		b = &e.buckets[c-e.base]
+	} else {
+		b = &e.far[farBucket(e.base, c)]
+	}
+	if b.f == nil {
+		b.f, e.err = os.CreateTemp(e.dir, "riblt-*")
+		if e.err != nil {
+			return
+		}
+		b.w = bufio.NewWriter(b.f)
+	}
+	e.record, e.err = appendHashedSymbol(e.record[:0], s)
+	if e.err != nil {
+		return
+	}
+	e.record = binary.LittleEndian.AppendUint64(e.record, m.prng)
+	e.record = binary.AppendUvarint(e.record, m.lastIdx)
+	var hdr [binary.MaxVarintLen64]byte
+	if _, err := b.w.Write(hdr[:binary.PutUvarint(hdr[:], uint64(len(e.record)))]); err != nil {
+		e.err = err
+		return
+	}
+	if _, err := b.w.Write(e.record); err != nil {
+		e.err = err
+	}
+}
+
+// farBucket returns the index of the far bucket for chunk c, which is in a
+// block after the one of chunk base.
+func farBucket(base, c int) int {
+	return bits.Len64(uint64(base/diskBuckets)^uint64(c/diskBuckets)) - 1
+}
+
+// produceChunk fills e.buf with the next chunk of coded symbols.
+func (e *DiskEncoder[T]) produceChunk() {
+	c := e.nextIdx / e.chunk
+	if c-e.base == diskBuckets {
+		// Redistribute the source symbols whose blocks differ from the
+		// current one at the highest bit that changes. They are either in
+		// the new block, or in far buckets of lower bits, which are empty
+		// because the lower bits of the old block are all ones. Source
+		// symbols in other far buckets stay, as the higher bits of the new
+		// block are the same as the old one.
+		k := farBucket(e.base, c)
+		e.base = c
+		far := e.far[k]
+		e.far[k] = diskBucket{}
+		e.scan(&far, func(s HashedSymbol[T], m randomMapping) {
+			e.store(s, m)
+		})
+	}
+	if e.buf == nil {
+		e.buf = make([]CodedSymbol[T], e.chunk)
+	}
+	for i := range e.buf {
+		e.buf[i] = emptyCodedSymbol[T]()
+	}
+	end := uint64(e.nextIdx + e.chunk)
+	b := e.buckets[c-e.base]
+	e.buckets[c-e.base] = diskBucket{}
+	e.scan(&b, func(s HashedSymbol[T], m randomMapping) {
+		for m.lastIdx < end {
+			cidx := int(m.lastIdx) - e.nextIdx
+			e.buf[cidx] = e.buf[cidx].apply(s, add)
+			m.next(e.mapping)
+		}
+		e.store(s, m)
+	})
+	e.nextIdx += e.chunk
+	e.pos = 0
+}
+
+// scan calls f on every source symbol in bucket b, and then removes b.
+func (e *DiskEncoder[T]) scan(b *diskBucket, f func(HashedSymbol[T], randomMapping)) {
+	defer b.remove()
+	if e.err != nil || b.f == nil {
+		return
+	}
+	if e.err = b.w.Flush(); e.err != nil {
+		return
+	}
+	if _, e.err = b.f.Seek(0, io.SeekStart); e.err != nil {
+		return
+	}
+	br := bufio.NewReader(b.f)
+	var record []byte
+	for e.err == nil {
+		n, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			e.err = err
+			return
+		}
+		if uint64(cap(record)) < n {
+			record = make([]byte, n)
+		}
+		record = record[:n]
+		if _, e.err = io.ReadFull(br, record); e.err != nil {
+			return
+		}
+		r := &reader{b: record}
+		s := readHashedSymbol[T](r)
+		m := randomMapping{r.uint64(), r.uvarint()}
+		if r.err != nil {
+			e.err = r.err
+			return
+		}
+		f(s, m)
+	}
+}
+
+// remove closes and deletes the file of b.
+func (b *diskBucket) remove() error {
+	if b.f == nil {
+		return nil
+	}
+	b.f.Close()
+	err := os.Remove(b.f.Name())
+	*b = diskBucket{}
+	return err
+}
@@ -0,0 +1,66 @@
+package riblt
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDiskEncoder(t *testing.T) {
+	dir := t.TempDir()
+	enc := Encoder[testSymbol]{}
+	// use short chunks so that source symbols are moved across many
+	// buckets and the far buckets are redistributed multiple times
+	disk := NewDiskEncoder[testSymbol](dir, 7)
+	for i := 0; i < 20000; i++ {
+		enc.AddSymbol(newTestSymbol(uint64(i)))
+		disk.AddSymbol(newTestSymbol(uint64(i)))
+	}
+	for i := 0; i < 5000; i++ {
+		if c1, c2 := enc.ProduceNextCodedSymbol(), disk.ProduceNextCodedSymbol(); c1 != c2 {
+			t.Fatalf("coded symbol %d differs from Encoder", i)
+		}
+	}
+	if disk.Err() != nil {
+		t.Fatal(disk.Err())
+	}
+	if err := disk.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("%d files left after Close", len(files))
+	}
+}
+
+func TestDecoderWithDiskEncoder(t *testing.T) {
+	enc := Encoder[testSymbol]{}
+	dec := Decoder[testSymbol]{}
+	local := NewDiskEncoder[testSymbol](t.TempDir(), 64)
+	defer local.Close()
+	dec.SetLocalSource(local)
+
+	var nextId uint64
+	for i := 0; i < 100; i++ {
+		local.AddSymbol(newTestSymbol(nextId))
+		nextId += 1
+		enc.AddSymbol(newTestSymbol(nextId))
+		nextId += 1
+	}
+	for i := 0; i < 5000; i++ {
+		enc.AddSymbol(newTestSymbol(nextId))
+		local.AddSymbol(newTestSymbol(nextId))
+		nextId += 1
+	}
+	for {
+		dec.AddCodedSymbol(enc.ProduceNextCodedSymbol())
+		dec.TryDecode()
+		if dec.Decoded() {
+			break
+		}
+	}
+	if local.Err() != nil {
+		t.Fatal(local.Err())
+	}
+	if len(dec.Remote()) != 100 || len(dec.Local()) != 100 {
+		t.Errorf("recovered %d remote and %d local symbols, expected 100 and 100", len(dec.Remote()), len(dec.Local()))
+	}
+}
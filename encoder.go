@@ -51,10 +51,12 @@ func (m mappingHeap) fixTail() {
 
 // codingWindow is a collection of source symbols and their mappings to coded symbols.
 type codingWindow[T Symbol[T]] struct {
-	symbols  []HashedSymbol[T] // source symbols
-	mappings []randomMapping   // mapping generators of the source symbols
-	queue    mappingHeap       // priority queue of source symbols by the next coded symbols they are mapped to
-	nextIdx  int               // index of the next coded symbol to be generated
+	symbols  []HashedSymbol[T]     // source symbols
+	mappings []randomMapping       // mapping generators of the source symbols
+	queue    mappingHeap           // priority queue of source symbols by the next coded symbols they are mapped to
+	nextIdx  int                   // index of the next coded symbol to be generated
+	mapping  Mapping               // mapping of source symbols to coded symbols, nil for RandomMapping
+	detector *CollisionDetector[T] // detector of colliding source symbols, nil if disabled
 }
 
 // addSymbol inserts a symbol to the codingWindow.
@@ -65,7 +67,10 @@ func (e *codingWindow[T]) addSymbol(t T) {
 
 // addHashedSymbol inserts a HashedSymbol to the codingWindow.
 func (e *codingWindow[T]) addHashedSymbol(t HashedSymbol[T]) {
-	e.addHashedSymbolWithMapping(t, randomMapping{t.Hash, 0})
+	if e.detector != nil {
+		e.detector.Add(t)
+	}
+	e.addHashedSymbolWithMapping(t, newMapping(e.mapping, t.Hash))
 }
 
 // addHashedSymbolWithMapping inserts a HashedSymbol and the current state of its mapping generator to the codingWindow.
@@ -87,7 +92,7 @@ func (e *codingWindow[T]) applyWindow(cw CodedSymbol[T], direction int64) CodedS
 	for e.queue[0].codedIdx == e.nextIdx {
 		cw = cw.apply(e.symbols[e.queue[0].sourceIdx], direction)
 		// generate the next mapping
-		nextMap := e.mappings[e.queue[0].sourceIdx].nextIndex()
+		nextMap := e.mappings[e.queue[0].sourceIdx].next(e.mapping)
 		e.queue[0].codedIdx = int(nextMap)
 		e.queue.fixHead()
 	}
@@ -95,8 +100,12 @@ func (e *codingWindow[T]) applyWindow(cw CodedSymbol[T], direction int64) CodedS
 	return cw
 }
 
-// reset clears a codingWindow.
+// reset clears a codingWindow. It keeps the Mapping of the codingWindow, and
+// keeps collision detection enabled if it is.
 func (e *codingWindow[T]) reset() {
+	if e.detector != nil {
+		e.detector.Reset()
+	}
 	if len(e.symbols) != 0 {
 		e.symbols = e.symbols[:0]
 	}
@@ -109,6 +118,12 @@ func (e *codingWindow[T]) reset() {
 	e.nextIdx = 0
 }
 
+// CodedSymbolSource produces the coded symbol sequence for a set, one coded
+// symbol at a time. Encoder, LazyEncoder, and DiskEncoder implement it.
+type CodedSymbolSource[T Symbol[T]] interface {
+	ProduceNextCodedSymbol() CodedSymbol[T]
+}
+
 // Encoder is an incremental encoder of Rateless IBLTs. Once initialized with a
 // set of source symbols by calling AddSymbol or AddHashedSymbol, a Encoder can
 // incrementally generate coded symbols in the infinite sequence defined for
@@ -128,13 +143,21 @@ func (e *Encoder[T]) AddHashedSymbol(s HashedSymbol[T]) {
 	(*codingWindow[T])(e).addHashedSymbol(s)
 }
 
+// SetMapping sets the Mapping of source symbols to coded symbols used by e,
+// which must be the same as the one used by the Decoder. A nil g stands for
+// RandomMapping, the default. It is undefined behavior to call SetMapping
+// after calling AddSymbol or AddHashedSymbol.
+func (e *Encoder[T]) SetMapping(g Mapping) {
+	e.mapping = g
+}
+
 // ProduceNextCodedSymbol returns the next coded symbol in the sequence.
 func (e *Encoder[T]) ProduceNextCodedSymbol() CodedSymbol[T] {
-	return (*codingWindow[T])(e).applyWindow(CodedSymbol[T]{}, add)
+	return (*codingWindow[T])(e).applyWindow(emptyCodedSymbol[T](), add)
 }
 
-// Reset clears e. It is more efficient to call Reset to reuse an existing
-// Encoder than creating a new one.
+// Reset clears e, but keeps its Mapping. It is more efficient to call Reset to
+// reuse an existing Encoder than creating a new one.
 func (e *Encoder[T]) Reset() {
 	(*codingWindow[T])(e).reset()
 }
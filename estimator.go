@@ -0,0 +1,197 @@
+package riblt
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// StrataEstimator estimates the size of the symmetric difference between two
+// sets, so that peers can choose the length of a Sketch before exchanging
+// one. It is the strata estimator by Eppstein et al.: source symbols are
+// partitioned into strata by the number of trailing zeros in their hashes,
+// so that stratum i receives a 1/2^(i+1) fraction of them, and each stratum
+// keeps a small IBLT of the hashes. Peers exchange their estimators, which
+// only depend on the hashes of the source symbols, using MarshalBinary and
+// UnmarshalBinary. Its zero value holds no strata, and is only useful as the
+// receiver of UnmarshalBinary; use NewStrataEstimator to create one.
+type StrataEstimator struct {
+	strata []*IBLT[hashSymbol]
+}
+
+// Default dimensions of a StrataEstimator. An estimator of such dimensions
+// takes about 20 KiB when serialized and handles differences of up to about
+// one million source symbols.
+const (
+	DefaultStrata      = 16
+	DefaultStrataCells = 80
+)
+
+// strataHashes is the number of cells each hash is inserted into in a stratum.
+const strataHashes = 3
+
+// NewStrataEstimator returns an empty StrataEstimator of the given number of
+// strata, where the IBLT of each stratum has the given number of cells. Both
+// peers must use the same dimensions.
+func NewStrataEstimator(strata, cells int) *StrataEstimator {
+	if strata <= 0 || strata > 64 {
+		panic("invalid number of strata")
+	}
+	e := &StrataEstimator{make([]*IBLT[hashSymbol], strata)}
+	for i := range e.strata {
+		e.strata[i] = NewIBLT[hashSymbol](cells, strataHashes)
+	}
+	return e
+}
+
+// AddHash inserts a source symbol, identified by its hash, to the set of which
+// e is an estimator.
+func (e *StrataEstimator) AddHash(hash uint64) {
+	i := bits.TrailingZeros64(hash)
+	if i >= len(e.strata) {
+		i = len(e.strata) - 1
+	}
+	e.strata[i].Insert(hashSymbol(hash))
+}
+
+// Estimate returns the estimated size of the symmetric difference between the
+// sets of which e and e2 are estimators. e and e2 must be of the same
+// dimensions. Neither is modified. It returns math.MaxInt if the difference
+// is too large to estimate, i.e., even the stratum of the fewest source
+// symbols fails to decode, or if the estimate overflows.
+func (e *StrataEstimator) Estimate(e2 *StrataEstimator) int {
+	if len(e.strata) != len(e2.strata) {
+		panic("estimating with StrataEstimators of different dimensions")
+	}
+	count := 0
+	for i := len(e.strata) - 1; i >= 0; i-- {
+		diff := NewIBLT[hashSymbol](e.strata[i].mapping.Cells, strataHashes)
+		copy(diff.cells, e.strata[i].cells)
+		diff.Subtract(e2.strata[i])
+		fwd, rev, succ := diff.Decode()
+		if !succ {
+			// strata i and below receive a 1-1/2^(i+1) fraction of the
+			// source symbols, and we have only decoded the rest, which
+			// tells nothing if it is none
+			if i == len(e.strata)-1 || count > math.MaxInt>>(i+1) {
+				return math.MaxInt
+			}
+			return count << (i + 1)
+		}
+		count += len(fwd) + len(rev)
+	}
+	return count
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. It returns an error if e
+// holds no strata.
+func (e *StrataEstimator) MarshalBinary() ([]byte, error) {
+	if len(e.strata) == 0 {
+		return nil, errors.New("riblt: StrataEstimator holds no strata")
+	}
+	cells := e.strata[0].mapping.Cells
+	b := []byte{estimatorVersion}
+	b = binary.AppendUvarint(b, uint64(len(e.strata)))
+	b = binary.AppendUvarint(b, uint64(cells))
+	for _, s := range e.strata {
+		for _, c := range s.cells {
+			b = binary.LittleEndian.AppendUint64(b, uint64(c.Symbol))
+			b = binary.LittleEndian.AppendUint64(b, c.Hash)
+			b = binary.AppendVarint(b, c.Count)
+		}
+	}
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It replaces the
+// content and dimensions of e.
+func (e *StrataEstimator) UnmarshalBinary(b []byte) error {
+	if len(b) == 0 || b[0] != estimatorVersion {
+		return errMalformedEstimator
+	}
+	b = b[1:]
+	strata, n := binary.Uvarint(b)
+	if n <= 0 || strata == 0 || strata > 64 {
+		return errMalformedEstimator
+	}
+	b = b[n:]
+	cells, n := binary.Uvarint(b)
+	if n <= 0 || cells < strataHashes || cells > uint64(len(b)) {
+		return errMalformedEstimator
+	}
+	b = b[n:]
+	// each cell takes at least 17 bytes, so check the length before
+	// allocating the cells
+	if strata*cells*17 > uint64(len(b)) {
+		return errMalformedEstimator
+	}
+	est := NewStrataEstimator(int(strata), int(cells))
+	for _, s := range est.strata {
+		for i := range s.cells {
+			if len(b) < 16 {
+				return errMalformedEstimator
+			}
+			s.cells[i].Symbol = hashSymbol(binary.LittleEndian.Uint64(b))
+			s.cells[i].Hash = binary.LittleEndian.Uint64(b[8:])
+			s.cells[i].Count, n = binary.Varint(b[16:])
+			if n <= 0 {
+				return errMalformedEstimator
+			}
+			b = b[16+n:]
+		}
+	}
+	if len(b) != 0 {
+		return errMalformedEstimator
+	}
+	*e = *est
+	return nil
+}
+
+// estimatorVersion is the version of the serialization format of
+// StrataEstimator.
+const estimatorVersion = 1
+
+var errMalformedEstimator = errors.New("riblt: malformed StrataEstimator")
+
+// SketchLength returns the recommended length of Sketches for a symmetric
+// difference of size d, such that decoding succeeds with probability at least
+// p, which must be in (0, 1). On average, decoding a difference of size d
+// takes about 1.35d coded symbols when d is large. The recommendation adds a
+// margin for the variance, which is relatively larger for small d, fitted to
+// simulations for p up to 0.99. It does not account for any error in d, so
+// callers using an estimate may want to inflate it first. It returns
+// math.MaxInt if the recommendation exceeds it.
+func SketchLength(d int, p float64) int {
+	if d <= 0 {
+		// the first coded symbol tells whether the sets are equal
+		return 1
+	}
+	z := math.Sqrt2 * math.Erfinv(2*p-1)
+	if z < 0 {
+		z = 0
+	}
+	fd := float64(d)
+	l := math.Ceil(1.35*fd + (0.8+z)*math.Sqrt(fd) + 4*z)
+	if !(l < math.MaxInt) {
+		return math.MaxInt
+	}
+	return int(l)
+}
+
+// hashSymbol is a source symbol that is the hash of another source symbol.
+type hashSymbol uint64
+
+// XOR implements Symbol.
+func (h hashSymbol) XOR(h2 hashSymbol) hashSymbol {
+	return h ^ h2
+}
+
+// Hash implements Symbol. It is the finalizer of SplitMix64, a bijective
+// function that is not homomorphic over XOR.
+func (h hashSymbol) Hash() uint64 {
+	z := uint64(h)
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
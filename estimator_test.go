@@ -0,0 +1,100 @@
+package riblt
+
+import (
+	"math"
+	"testing"
+)
+
+func TestStrataEstimator(t *testing.T) {
+	var nextId uint64
+	for _, d := range []int{0, 10, 100, 1000, 10000} {
+		a := NewStrataEstimator(DefaultStrata, DefaultStrataCells)
+		b := NewStrataEstimator(DefaultStrata, DefaultStrataCells)
+		for i := 0; i < d; i++ {
+			a.AddHash(newTestSymbol(nextId).Hash())
+			nextId += 1
+		}
+		for i := 0; i < 10000; i++ {
+			h := newTestSymbol(nextId).Hash()
+			nextId += 1
+			a.AddHash(h)
+			b.AddHash(h)
+		}
+
+		// b receives a over the wire
+		buf, err := a.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		recv := &StrataEstimator{}
+		if err := recv.UnmarshalBinary(buf); err != nil {
+			t.Fatal(err)
+		}
+		est := b.Estimate(recv)
+		if est < d/2 || est > d*2 {
+			t.Errorf("estimated %d for a difference of size %d", est, d)
+		}
+		if d <= 10 && est != d {
+			t.Errorf("estimated %d for a small difference of size %d", est, d)
+		}
+	}
+}
+
+func TestStrataEstimatorOverflow(t *testing.T) {
+	// the top stratum receives about 50 source symbols, more than its 10
+	// cells can decode
+	a := NewStrataEstimator(2, 10)
+	b := NewStrataEstimator(2, 10)
+	for i := uint64(0); i < 100; i++ {
+		a.AddHash(newTestSymbol(i).Hash())
+	}
+	if est := a.Estimate(b); est != math.MaxInt {
+		t.Errorf("estimated %d for a difference overflowing the top stratum", est)
+	}
+	if l := SketchLength(math.MaxInt, 0.99); l != math.MaxInt {
+		t.Errorf("got Sketch length %d for the largest difference", l)
+	}
+}
+
+func TestStrataEstimatorMalformed(t *testing.T) {
+	a := NewStrataEstimator(4, 10)
+	a.AddHash(12345)
+	buf, _ := a.MarshalBinary()
+	e := &StrataEstimator{}
+	// a short input announcing 64 strata of many cells
+	huge := []byte{estimatorVersion, 64, 0x80, 0x80, 0x01}
+	huge = append(huge, make([]byte, 1<<14)...)
+	for _, b := range [][]byte{nil, buf[:1], buf[:len(buf)-1], append(buf, 0), huge} {
+		if err := e.UnmarshalBinary(b); err == nil {
+			t.Errorf("accepted malformed input of length %d", len(b))
+		}
+	}
+	if _, err := (&StrataEstimator{}).MarshalBinary(); err == nil {
+		t.Errorf("marshaled an estimator without strata")
+	}
+}
+
+func TestSketchLength(t *testing.T) {
+	var nextId uint64
+	for _, d := range []int{3, 30, 300} {
+		for _, p := range []float64{0.9, 0.99} {
+			m := SketchLength(d, p)
+			trials := 300
+			nsucc := 0
+			for tr := 0; tr < trials; tr++ {
+				s := make(Sketch[testSymbol], m)
+				for i := 0; i < d; i++ {
+					s.AddSymbol(newTestSymbol(nextId))
+					nextId += 1
+				}
+				if _, _, succ := s.Decode(); succ {
+					nsucc += 1
+				}
+			}
+			// allow for sampling error
+			if rate := float64(nsucc) / float64(trials); rate < p-0.03 {
+				t.Errorf("d=%d: decoded with probability %.3f at length %d, expected %.2f", d, rate, m, p)
+			}
+		}
+	}
+}
@@ -1,9 +1,7 @@
 package riblt_test
 
 import (
-	"encoding/binary"
 	"fmt"
-	"github.com/dchest/siphash"
 	"github.com/yangl1996/riblt"
 )
 
@@ -17,11 +15,14 @@ func (t item) XOR(t2 item) item {
 	return t ^ t2
 }
 
-// Hash hashes t using SipHash.
+// hasher hashes items using SipHash, under a key that Alice and Bob agree on.
+// In practice, they would derive the key from a secret they share and an
+// identifier of the session using riblt.DeriveKey.
+var hasher = riblt.Hasher{Key: riblt.Key{123, 456}}
+
+// Hash hashes t using hasher.
 func (t item) Hash() uint64 {
-	buf := [8]byte{}
-	binary.LittleEndian.PutUint64(buf[0:8], uint64(t))
-	return siphash.Hash(123, 456, buf[:])
+	return hasher.Uint64(uint64(t))
 }
 
 func Example() {
@@ -63,3 +64,37 @@ func Example() {
 	// 11 is exclusive to Bob
 	// 2 coded symbols sent
 }
+
+func ExampleDecoder_SetLocalSource() {
+	alice := []item{1, 2, 3, 4, 5, 6, 7, 8, 9, 10} // only Alice has 2
+	bob := []item{1, 3, 4, 5, 6, 7, 8, 9, 10, 11}  // only Bob has 11
+
+	// Bob keeps a Sketch of his set up to date, long enough for the
+	// differences he expects to see.
+	sketch := make(riblt.Sketch[item], 32)
+	for _, v := range bob {
+		sketch.AddSymbol(v)
+	}
+
+	enc := riblt.Encoder[item]{}
+	for _, v := range alice {
+		enc.AddSymbol(v)
+	}
+	// Instead of adding his set to the decoder, Bob lets the decoder take
+	// coded symbols of his set from the Sketch.
+	dec := riblt.Decoder[item]{}
+	dec.SetLocalSource(sketch.Source())
+	for {
+		dec.AddCodedSymbol(enc.ProduceNextCodedSymbol())
+		dec.TryDecode()
+		if dec.Decoded() {
+			break
+		}
+	}
+
+	fmt.Println(dec.Remote()[0].Symbol, "is exclusive to Alice")
+	fmt.Println(dec.Local()[0].Symbol, "is exclusive to Bob")
+	// Output:
+	// 2 is exclusive to Alice
+	// 11 is exclusive to Bob
+}
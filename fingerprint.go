@@ -0,0 +1,160 @@
+package riblt
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	// ErrNoFingerprint is returned when the Fingerprint of a set is not
+	// known.
+	ErrNoFingerprint = errors.New("riblt: local source does not have a fingerprint")
+	// ErrFingerprintMismatch is returned when the symmetric difference
+	// recovered by a Decoder does not match the Fingerprint of the remote
+	// set.
+	ErrFingerprintMismatch = errors.New("riblt: recovered difference does not match fingerprint")
+)
+
+// Fingerprint is a summary of a set of source symbols that does not depend on
+// the order in which they are inserted: the number of source symbols, the XOR
+// of their hashes, and the sum of the hashes of their hashes. Count and Hash
+// are the ones of the first coded symbol of the set, to which every source
+// symbol is mapped under RandomMapping and AlphaMapping. Peers may exchange
+// fingerprints before reconciling, and skip reconciliation if they are equal,
+// in which case the sets are equal with high probability. Its zero value is
+// the fingerprint of the empty set.
+//
+// Sum allows checking the symmetric difference recovered by a Decoder. See
+// Decoder.Verify. A coded symbol that mixes several source symbols may pass
+// the check for being pure, in which case the Decoder recovers a wrong source
+// symbol, whose hash is the XOR of the hashes of the source symbols mixed.
+// Count and Hash do not tell the difference, but Sum does with high
+// probability, as it is not homomorphic over XOR.
+type Fingerprint struct {
+	Count int64
+	Hash  uint64
+	Sum   uint64
+}
+
+// Add returns the fingerprint of the set with the source symbol of the given
+// hash inserted.
+func (f Fingerprint) Add(hash uint64) Fingerprint {
+	return Fingerprint{f.Count + 1, f.Hash ^ hash, f.Sum + hashSymbol(hash).Hash()}
+}
+
+// Remove returns the fingerprint of the set with the source symbol of the
+// given hash deleted.
+func (f Fingerprint) Remove(hash uint64) Fingerprint {
+	return Fingerprint{f.Count - 1, f.Hash ^ hash, f.Sum - hashSymbol(hash).Hash()}
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. The fingerprint is
+// serialized as the little-endian Hash, Count, and Sum, in that order.
+func (f Fingerprint) MarshalBinary() ([]byte, error) {
+	b := binary.LittleEndian.AppendUint64(nil, f.Hash)
+	b = binary.LittleEndian.AppendUint64(b, uint64(f.Count))
+	return binary.LittleEndian.AppendUint64(b, f.Sum), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (f *Fingerprint) UnmarshalBinary(data []byte) error {
+	if len(data) != 24 {
+		return ErrMalformed
+	}
+	f.Hash = binary.LittleEndian.Uint64(data)
+	f.Count = int64(binary.LittleEndian.Uint64(data[8:]))
+	f.Sum = binary.LittleEndian.Uint64(data[16:])
+	return nil
+}
+
+// fingerprint returns the fingerprint of the source symbols in e.
+func (e *codingWindow[T]) fingerprint() Fingerprint {
+	var f Fingerprint
+	for _, s := range e.symbols {
+		f = f.Add(s.Hash)
+	}
+	return f
+}
+
+// Fingerprint returns the Fingerprint of the set of e. It takes time linear to
+// the size of the set.
+func (e *Encoder[T]) Fingerprint() Fingerprint {
+	return (*codingWindow[T])(e).fingerprint()
+}
+
+// fingerprinter is implemented by CodedSymbolSources that know the Fingerprint
+// of their sets.
+type fingerprinter interface {
+	Fingerprint() Fingerprint
+}
+
+// Fingerprint returns the Fingerprint of B, the local set of d, made of the
+// source symbols added by AddSymbol and AddHashedSymbol, and the set of the
+// local source, if any. It returns ErrNoFingerprint if d has a local source
+// that does not have a Fingerprint method, like the one of a Sketch. Encoder
+// and IndexSource have one. It takes time linear to the number of source
+// symbols added to d.
+func (d *Decoder[T]) Fingerprint() (Fingerprint, error) {
+	f := d.window.fingerprint()
+	if d.source != nil {
+		src, ok := d.source.(fingerprinter)
+		if !ok {
+			return f, ErrNoFingerprint
+		}
+		sf := src.Fingerprint()
+		f = Fingerprint{f.Count + sf.Count, f.Hash ^ sf.Hash, f.Sum + sf.Sum}
+	}
+	return f, nil
+}
+
+// Verify checks the symmetric difference recovered by d, which must be
+// decoded, against remote, the Fingerprint of A. It returns
+// ErrFingerprintMismatch if the Fingerprint of B with the source symbols in
+// Remote inserted and the ones in Local deleted differs from remote, in which
+// case some recovered source symbols are wrong. See Fingerprint for how this
+// happens. Then, d should be passed more coded symbols, after which a wrong
+// source symbol is recovered again as exclusive to the other side, so that it
+// appears in both Remote and Local, and Verify succeeds. Source symbols that
+// appear in both Remote and Local are not in the symmetric difference.
+func (d *Decoder[T]) Verify(remote Fingerprint) error {
+	f, err := d.Fingerprint()
+	if err != nil {
+		return err
+	}
+	v := verifier[T]{d: d, f: f}
+	return v.verify(remote)
+}
+
+// verifier checks the symmetric difference recovered by a Decoder like
+// Decoder.Verify, but keeps the Fingerprint of B with the source symbols
+// recovered so far applied, so that checking again after more source symbols
+// are recovered only takes time linear to the new ones.
+type verifier[T Symbol[T]] struct {
+	d       *Decoder[T]
+	f       Fingerprint // Fingerprint of B with the first nremote and nlocal recovered source symbols applied
+	nremote int
+	nlocal  int
+}
+
+func (v *verifier[T]) verify(remote Fingerprint) error {
+	for _, s := range v.d.remote.symbols[v.nremote:] {
+		v.f = v.f.Add(s.Hash)
+	}
+	for _, s := range v.d.local.symbols[v.nlocal:] {
+		v.f = v.f.Remove(s.Hash)
+	}
+	v.nremote = len(v.d.remote.symbols)
+	v.nlocal = len(v.d.local.symbols)
+	if v.f != remote {
+		return ErrFingerprintMismatch
+	}
+	return nil
+}
+
+// Fingerprint returns the Fingerprint of the set, and the version of the set.
+// It takes constant time.
+func (x *SketchIndex[T]) Fingerprint() (Fingerprint, uint64) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.fingerprint, x.version
+}
@@ -0,0 +1,214 @@
+package riblt
+
+import (
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	enc := Encoder[testSymbol]{}
+	dec := Decoder[testSymbol]{}
+	x := NewSketchIndex[testSymbol](0, nil)
+	for i := uint64(0); i < 100; i++ {
+		enc.AddSymbol(newTestSymbol(i))
+		dec.AddSymbol(newTestSymbol(99 - i))
+		x.AddSymbol(newTestSymbol(i))
+	}
+	x.AddSymbol(newTestSymbol(100))
+	x.RemoveSymbol(newTestSymbol(100))
+
+	f := enc.Fingerprint()
+	if df, err := dec.Fingerprint(); err != nil || f != df {
+		t.Errorf("fingerprint depends on the order of insertion")
+	}
+	if xf, _ := x.Fingerprint(); xf != f {
+		t.Errorf("fingerprint of SketchIndex differs from the one of Encoder")
+	}
+	c := enc.ProduceNextCodedSymbol()
+	if f.Count != c.Count || f.Hash != c.Hash {
+		t.Errorf("fingerprint differs from the first coded symbol")
+	}
+	if f == (Fingerprint{}) || f.Remove(newTestSymbol(0).Hash()) == f {
+		t.Errorf("fingerprint does not depend on the set")
+	}
+
+	data, _ := f.MarshalBinary()
+	var f2 Fingerprint
+	if err := f2.UnmarshalBinary(data); err != nil || f2 != f {
+		t.Errorf("restored fingerprint differs: %v", err)
+	}
+}
+
+// newCollidingSets returns two disjoint sets of equal sizes, whose source
+// symbols have hashes of the same XOR, so that their fingerprints only differ
+// in Sum. Such sets are found by Gaussian elimination over the hashes.
+func newCollidingSets() ([]testSymbol, []testSymbol) {
+	// basis[b] is a combination of source symbols, of which the XOR of
+	// hashes has b as its highest bit, or nil
+	type combination struct {
+		hash    uint64
+		symbols map[uint64]bool
+	}
+	var basis [64]*combination
+	var odd map[uint64]bool
+	for i := uint64(0); ; i++ {
+		c := combination{newTestSymbol(i).Hash(), map[uint64]bool{i: true}}
+		for b := 63; b >= 0 && c.hash != 0; b-- {
+			if c.hash&(1<<b) == 0 {
+				continue
+			}
+			if basis[b] == nil {
+				basis[b] = &c
+				break
+			}
+			c.hash ^= basis[b].hash
+			for j, in := range basis[b].symbols {
+				if in {
+					c.symbols[j] = !c.symbols[j]
+				}
+			}
+		}
+		if c.hash != 0 {
+			continue
+		}
+		// the XOR of hashes of the source symbols in c is 0, and so is the
+		// XOR of two such combinations of odd sizes
+		for j, in := range c.symbols {
+			if !in {
+				delete(c.symbols, j)
+			}
+		}
+		if len(c.symbols)%2 == 1 {
+			if odd == nil {
+				odd = c.symbols
+				continue
+			}
+			for j := range odd {
+				if c.symbols[j] {
+					delete(c.symbols, j)
+				} else {
+					c.symbols[j] = true
+				}
+			}
+		}
+		var a, b []testSymbol
+		for j := range c.symbols {
+			if len(a) < len(c.symbols)/2 {
+				a = append(a, newTestSymbol(j))
+			} else {
+				b = append(b, newTestSymbol(j))
+			}
+		}
+		return a, b
+	}
+}
+
+// newCollidingEncoderDecoder returns an Encoder and a Decoder of sets that
+// share 1000 source symbols, and differ in the sets from newCollidingSets.
+func newCollidingEncoderDecoder() (*Encoder[testSymbol], *Decoder[testSymbol]) {
+	a, b := newCollidingSets()
+	enc := &Encoder[testSymbol]{}
+	dec := &Decoder[testSymbol]{}
+	for _, s := range a {
+		enc.AddSymbol(s)
+	}
+	for _, s := range b {
+		dec.AddSymbol(s)
+	}
+	for i := uint64(1 << 32); i < 1<<32+1000; i++ {
+		enc.AddSymbol(newTestSymbol(i))
+		dec.AddSymbol(newTestSymbol(i))
+	}
+	return enc, dec
+}
+
+func TestVerify(t *testing.T) {
+	enc := Encoder[testSymbol]{}
+	dec := Decoder[testSymbol]{}
+	for i := uint64(0); i < 1000; i++ {
+		enc.AddSymbol(newTestSymbol(i))
+		dec.AddSymbol(newTestSymbol(i + 100))
+	}
+	for !dec.Decoded() || len(dec.Remote()) == 0 {
+		dec.AddCodedSymbol(enc.ProduceNextCodedSymbol())
+		dec.TryDecode()
+	}
+	f := enc.Fingerprint()
+	if err := dec.Verify(f); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace remote symbols a, b and local symbol c by a wrong remote
+	// symbol a+b-c, as if it were recovered from a coded symbol mixing them.
+	// Only Sum tells the difference.
+	a, b, c := dec.remote.symbols[0], dec.remote.symbols[1], dec.local.symbols[0]
+	dec.remote.symbols = append(dec.remote.symbols[2:], HashedSymbol[testSymbol]{a.Symbol.XOR(b.Symbol).XOR(c.Symbol), a.Hash ^ b.Hash ^ c.Hash})
+	dec.local.symbols = dec.local.symbols[1:]
+	if err := dec.Verify(f); err != ErrFingerprintMismatch {
+		t.Errorf("got error %v, expected ErrFingerprintMismatch", err)
+	}
+
+	// The first coded symbol of sets with fingerprints of the same Count and
+	// Hash is decoded, but decoding it recovers nothing.
+	enc2, dec2 := newCollidingEncoderDecoder()
+	f = enc2.Fingerprint()
+	if df, _ := dec2.Fingerprint(); df.Count != f.Count || df.Hash != f.Hash || df == f {
+		t.Fatalf("fingerprints %v and %v do not only differ in Sum", f, df)
+	}
+	dec2.AddCodedSymbol(enc2.ProduceNextCodedSymbol())
+	dec2.TryDecode()
+	if !dec2.Decoded() {
+		t.Fatalf("decoder did not finish")
+	}
+	if err := dec2.Verify(f); err != ErrFingerprintMismatch {
+		t.Errorf("got error %v, expected ErrFingerprintMismatch", err)
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	enc := Encoder[testSymbol]{}
+	dec := Decoder[testSymbol]{}
+	for i := uint64(0); i < 1000; i++ {
+		enc.AddSymbol(newTestSymbol(i))
+		dec.AddSymbol(newTestSymbol(i + 100))
+	}
+	f := enc.Fingerprint()
+	local, _ := dec.Fingerprint()
+	v := verifier[testSymbol]{d: &dec, f: local}
+	// checking repeatedly as source symbols are recovered agrees with
+	// checking from scratch
+	for i := 0; i < 1000; i++ {
+		dec.AddCodedSymbol(enc.ProduceNextCodedSymbol())
+		dec.TryDecode()
+		if err1, err2 := v.verify(f), dec.Verify(f); err1 != err2 {
+			t.Fatalf("coded symbol %d: incremental check got %v, expected %v", i, err1, err2)
+		}
+	}
+	if err := v.verify(f); err != nil {
+		t.Errorf("decoded difference failed the check: %v", err)
+	}
+}
+
+func TestVerifyLocalSource(t *testing.T) {
+	enc := Encoder[testSymbol]{}
+	local := Encoder[testSymbol]{}
+	s := NewSketch[testSymbol](1000)
+	for i := uint64(0); i < 1000; i++ {
+		enc.AddSymbol(newTestSymbol(i))
+		local.AddSymbol(newTestSymbol(i + 100))
+		s.AddSymbol(newTestSymbol(i + 100))
+	}
+	dec := Decoder[testSymbol]{}
+	dec.SetLocalSource(&local)
+	for !dec.Decoded() || len(dec.Remote()) == 0 {
+		dec.AddCodedSymbol(enc.ProduceNextCodedSymbol())
+		dec.TryDecode()
+	}
+	if err := dec.Verify(enc.Fingerprint()); err != nil {
+		t.Error(err)
+	}
+	dec.Reset()
+	dec.SetLocalSource(s.Source())
+	if _, err := dec.Fingerprint(); err != ErrNoFingerprint {
+		t.Errorf("got error %v for a Sketch source, expected ErrNoFingerprint", err)
+	}
+}
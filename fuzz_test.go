@@ -0,0 +1,235 @@
+package riblt
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// fuzzSymbol is a small value-typed source symbol.
+type fuzzSymbol uint64
+
+func (s fuzzSymbol) XOR(s2 fuzzSymbol) fuzzSymbol {
+	return s ^ s2
+}
+
+func (s fuzzSymbol) Hash() uint64 {
+	return hashSymbol(s).Hash()
+}
+
+// boxSymbol is a pointer-backed source symbol, whose zero value is nil. XOR
+// allocates a new box, so it never modifies its operands.
+type boxSymbol = *box
+
+type box struct {
+	v uint64
+}
+
+func (b *box) XOR(b2 *box) *box {
+	r := &box{}
+	if b != nil {
+		r.v = b.v
+	}
+	if b2 != nil {
+		r.v ^= b2.v
+	}
+	return r
+}
+
+func (b *box) Hash() uint64 {
+	if b == nil {
+		return hashSymbol(0).Hash()
+	}
+	return hashSymbol(b.v).Hash()
+}
+
+// fuzzSets derives a pair of sets from seed, where the sizes of the exclusive
+// and the common parts are bounded.
+func fuzzSets(seed uint64, nlocal, nremote, ncommon uint8) (local, remote, common []uint64) {
+	next := func() uint64 {
+		seed += 1
+		// avoid 0, which is the identity element
+		return hashSymbol(seed).Hash() | 1
+	}
+	for i := 0; i < int(nlocal%64); i++ {
+		local = append(local, next())
+	}
+	for i := 0; i < int(nremote%64); i++ {
+		remote = append(remote, next())
+	}
+	for i := 0; i < int(ncommon); i++ {
+		common = append(common, next())
+	}
+	return
+}
+
+// checkDifference checks that got contains exactly the source symbols in exp.
+func checkDifference[T Symbol[T]](t *testing.T, name string, got []HashedSymbol[T], exp []uint64, value func(T) uint64) {
+	if len(got) != len(exp) {
+		t.Fatalf("recovered %d %s symbols, expected %d", len(got), name, len(exp))
+	}
+	set := make(map[uint64]bool)
+	for _, v := range exp {
+		set[v] = true
+	}
+	for _, s := range got {
+		if !set[value(s.Symbol)] {
+			t.Fatalf("recovered unexpected %s symbol %d", name, value(s.Symbol))
+		}
+		delete(set, value(s.Symbol))
+	}
+}
+
+// fuzzReconcile reconciles the sets derived from seed, passing coded symbols
+// to the Decoder in batches whose sizes are given by batches, and checks the
+// result. It does so twice to exercise Reset.
+func fuzzReconcile[T Symbol[T]](t *testing.T, mk func(uint64) T, value func(T) uint64, seed uint64, nlocal, nremote, ncommon uint8, batches []byte) {
+	local, remote, common := fuzzSets(seed, nlocal, nremote, ncommon)
+	enc := Encoder[T]{}
+	dec := Decoder[T]{}
+	for round := 0; round < 2; round++ {
+		enc.Reset()
+		dec.Reset()
+		for _, v := range local {
+			dec.AddSymbol(mk(v))
+		}
+		for _, v := range remote {
+			enc.AddSymbol(mk(v))
+		}
+		for _, v := range common {
+			enc.AddSymbol(mk(v))
+			dec.AddSymbol(mk(v))
+		}
+		limit := 100 * (len(local) + len(remote) + 1)
+		sent := 0
+		for b := 0; ; b++ {
+			n := 1
+			if len(batches) != 0 {
+				n = int(batches[b%len(batches)])%16 + 1
+			}
+			for i := 0; i < n; i++ {
+				dec.AddCodedSymbol(enc.ProduceNextCodedSymbol())
+			}
+			sent += n
+			dec.TryDecode()
+			if dec.Decoded() {
+				break
+			}
+			if sent > limit {
+				t.Fatalf("not decoded after %d coded symbols", sent)
+			}
+		}
+		checkDifference(t, "remote", dec.Remote(), remote, value)
+		checkDifference(t, "local", dec.Local(), local, value)
+	}
+}
+
+func FuzzEncodeAndDecode(f *testing.F) {
+	f.Add(uint64(0), uint8(0), uint8(0), uint8(0), []byte{})
+	f.Add(uint64(1), uint8(1), uint8(1), uint8(10), []byte{0})
+	f.Add(uint64(2), uint8(20), uint8(30), uint8(100), []byte{3, 15, 7})
+	f.Add(uint64(3), uint8(63), uint8(0), uint8(255), []byte{255})
+	f.Fuzz(func(t *testing.T, seed uint64, nlocal, nremote, ncommon uint8, batches []byte) {
+		fuzzReconcile(t, func(v uint64) fuzzSymbol { return fuzzSymbol(v) }, func(s fuzzSymbol) uint64 { return uint64(s) },
+			seed, nlocal, nremote, ncommon, batches)
+		fuzzReconcile(t, func(v uint64) boxSymbol { return &box{v} }, func(s boxSymbol) uint64 { return s.v },
+			seed, nlocal, nremote, ncommon, batches)
+	})
+}
+
+func FuzzSketch(f *testing.F) {
+	f.Add(uint64(0), uint8(0), uint8(0), uint8(0), uint16(1))
+	f.Add(uint64(1), uint8(5), uint8(3), uint8(50), uint16(20))
+	f.Add(uint64(2), uint8(40), uint8(40), uint8(100), uint16(30))
+	f.Fuzz(func(t *testing.T, seed uint64, nlocal, nremote, ncommon uint8, size uint16) {
+		local, remote, common := fuzzSets(seed, nlocal, nremote, ncommon)
+		s1 := make(Sketch[fuzzSymbol], size%512)
+		s2 := make(Sketch[fuzzSymbol], size%512)
+		for _, v := range remote {
+			s1.AddSymbol(fuzzSymbol(v))
+		}
+		for _, v := range local {
+			s2.AddSymbol(fuzzSymbol(v))
+		}
+		for _, v := range common {
+			s1.AddSymbol(fuzzSymbol(v))
+			s2.AddSymbol(fuzzSymbol(v))
+			// a removed symbol must leave no trace
+			s2.AddSymbol(fuzzSymbol(v + 1))
+			s2.RemoveSymbol(fuzzSymbol(v + 1))
+		}
+		s1.Subtract(s2)
+		fwd, rev, succ := s1.Decode()
+		if !succ {
+			return
+		}
+		if len(s1) == 0 {
+			return
+		}
+		value := func(s fuzzSymbol) uint64 { return uint64(s) }
+		checkDifference(t, "forward", fwd, remote, value)
+		checkDifference(t, "reverse", rev, local, value)
+	})
+}
+
+func FuzzDecodeArbitrary(f *testing.F) {
+	f.Add([]byte{}, []byte{})
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8}, []byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1})
+	f.Fuzz(func(t *testing.T, local []byte, coded []byte) {
+		// The local set and the coded symbols are arbitrary. There is no
+		// correct answer, but the Decoder must not panic.
+		dec := Decoder[fuzzSymbol]{}
+		for len(local) >= 8 {
+			dec.AddSymbol(fuzzSymbol(binary.LittleEndian.Uint64(local)))
+			local = local[8:]
+		}
+		for len(coded) >= 17 {
+			c := CodedSymbol[fuzzSymbol]{}
+			c.Symbol = fuzzSymbol(binary.LittleEndian.Uint64(coded))
+			// Make the hash consistent with the symbol for some of the
+			// inputs, so that they are considered decodable.
+			if coded[8]&1 == 0 {
+				c.Hash = c.Symbol.Hash()
+			} else {
+				c.Hash = binary.LittleEndian.Uint64(coded[8:])
+			}
+			c.Count = int64(int8(coded[16]))
+			dec.AddCodedSymbol(c)
+			if coded[16]&1 == 0 {
+				dec.TryDecode()
+			}
+			coded = coded[17:]
+		}
+		dec.TryDecode()
+		dec.Decoded()
+		dec.Stats()
+	})
+}
+
+func FuzzUnmarshalDecoder(f *testing.F) {
+	enc := Encoder[testSymbol]{}
+	dec := Decoder[testSymbol]{}
+	for i := uint64(0); i < 10; i++ {
+		enc.AddSymbol(newTestSymbol(i))
+		dec.AddSymbol(newTestSymbol(i + 5))
+	}
+	var cs []CodedSymbol[testSymbol]
+	for i := 0; i < 20; i++ {
+		cs = append(cs, enc.ProduceNextCodedSymbol())
+	}
+	f.Add(func() []byte { b, _ := dec.MarshalBinary(); return b }())
+	dec.AddCodedSymbolAt(3, cs[3])
+	dec.AddCodedSymbols(cs[:5])
+	f.Add(func() []byte { b, _ := dec.MarshalBinary(); return b }())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Arbitrary data must be either rejected, or restore a Decoder that
+		// keeps decoding without panicking.
+		dec := Decoder[testSymbol]{}
+		if dec.UnmarshalBinary(data) != nil {
+			return
+		}
+		dec.AddCodedSymbolsAt(len(dec.cs)/2, cs)
+		dec.AddCodedSymbols(cs)
+		dec.TryDecode()
+		dec.Stats()
+	})
+}
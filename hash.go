@@ -0,0 +1,144 @@
+package riblt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/bits"
+	"unsafe"
+
+	"github.com/dchest/siphash"
+)
+
+// Key is the 128-bit key of a keyed hash function.
+type Key [2]uint64
+
+// defaultKey is the key used by Bytes.Hash and Digest.Hash.
+var defaultKey = Key{0x736f6d6570736575, 0x646f72616e646f6d}
+
+// DeriveKey derives a Key from a secret shared by the peers and an identifier
+// of the session, e.g., a nonce chosen by one of them, by hashing them with
+// SHA-256. Using a key unknown to third parties keeps them from crafting
+// source symbols whose hashes collide, and using a new key for each session
+// keeps collisions that happen by chance from recurring. Both peers must
+// derive the key from the same secret and session, as hashes under different
+// keys are unrelated.
+func DeriveKey(secret, session []byte) Key {
+	h := sha256.New()
+	h.Write([]byte("riblt key"))
+	var n [binary.MaxVarintLen64]byte
+	h.Write(n[:binary.PutUvarint(n[:], uint64(len(secret)))])
+	h.Write(secret)
+	h.Write(session)
+	sum := h.Sum(nil)
+	return Key{binary.LittleEndian.Uint64(sum[0:8]), binary.LittleEndian.Uint64(sum[8:16])}
+}
+
+// HashFunc is a keyed 64-bit hash function of byte strings. SipHash and
+// FastHash are HashFuncs. To be used by Symbol.Hash, it must not be
+// homomorphic over XOR, i.e., the hash of the XOR of two byte strings must not
+// be related to their hashes. It must not modify b, which Hasher may reuse.
+type HashFunc func(k Key, b []byte) uint64
+
+// SipHash is SipHash-2-4 of b under key k. It is a pseudorandom function, so
+// peers who do not know the key cannot find source symbols whose hashes
+// collide. It should be used when the sets may contain source symbols chosen
+// by untrusted parties.
+func SipHash(k Key, b []byte) uint64 {
+	return siphash.Hash(k[0], k[1], b)
+}
+
+// Primes used by FastHash, taken from wyhash.
+const (
+	fastPrime0 = 0xa0761d6478bd642f
+	fastPrime1 = 0xe7037ed1a0b428db
+	fastPrime2 = 0x8ebc6af09c88c6e3
+	fastPrime3 = 0x589965cc75374cc3
+)
+
+// fastMix multiplies a and b into a 128-bit product, and folds it into 64
+// bits.
+func fastMix(a, b uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	return hi ^ lo
+}
+
+// FastHash is a keyed hash of b in the style of xxh3 and wyhash, which
+// consumes 16 bytes at a time with a 64-bit by 64-bit multiplication. It is
+// several times faster than SipHash, especially for short byte strings, and
+// distributes hashes well, but it is not a pseudorandom function: a party
+// who observes some hashes may be able to craft colliding source symbols. It
+// should only be used when the source symbols are not chosen by untrusted
+// parties.
+func FastHash(k Key, b []byte) uint64 {
+	n := uint64(len(b))
+	seed := k[0] ^ fastPrime0
+	for len(b) > 16 {
+		seed = fastMix(binary.LittleEndian.Uint64(b[0:8])^k[1]^fastPrime1, binary.LittleEndian.Uint64(b[8:16])^seed)
+		b = b[16:]
+	}
+	// the last 1 to 16 bytes are read as two possibly overlapping words
+	var x, y uint64
+	switch l := len(b); {
+	case l >= 8:
+		x = binary.LittleEndian.Uint64(b)
+		y = binary.LittleEndian.Uint64(b[l-8:])
+	case l >= 4:
+		x = uint64(binary.LittleEndian.Uint32(b))
+		y = uint64(binary.LittleEndian.Uint32(b[l-4:]))
+	case l > 0:
+		x = uint64(b[0])<<16 | uint64(b[l/2])<<8 | uint64(b[l-1])
+	}
+	h := fastMix(x^k[1]^fastPrime1, y^seed)
+	return fastMix(h^n^fastPrime2, k[0]^k[1]^fastPrime3)
+}
+
+// Hasher hashes values of common types under a key, for implementing
+// Symbol.Hash. Since Hash takes no arguments, a Hasher is typically held in a
+// package-level variable, or in the source symbols themselves. Its zero value
+// hashes using SipHash under the all-zero key.
+type Hasher struct {
+	// Key is the key of the hash function, e.g., derived by DeriveKey.
+	Key Key
+	// Func is the hash function. If nil, SipHash is used.
+	Func HashFunc
+}
+
+// Bytes returns the hash of b.
+func (h Hasher) Bytes(b []byte) uint64 {
+	if h.Func == nil {
+		return SipHash(h.Key, b)
+	}
+	return h.Func(h.Key, b)
+}
+
+// String returns the hash of s, which equals the hash of []byte(s).
+func (h Hasher) String(s string) uint64 {
+	if h.Func == nil {
+		// SipHash does not modify b, so we avoid copying s
+		return SipHash(h.Key, unsafe.Slice(unsafe.StringData(s), len(s)))
+	}
+	// a modification by Func must not reach the immutable memory of s
+	return h.Func(h.Key, []byte(s))
+}
+
+// Uint64 returns the hash of v, which equals the hash of its 8-byte
+// little-endian encoding.
+func (h Hasher) Uint64(v uint64) uint64 {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	return h.Bytes(b[:])
+}
+
+// Value returns the hash of v, which equals the hash of its little-endian
+// encoding by binary.Write. v must be a fixed-size value, or a slice of or
+// pointer to fixed-size values, e.g., a struct of integers and arrays. Since
+// padding is not encoded, values that are equal have equal hashes. It panics
+// if v cannot be encoded.
+func (h Hasher) Value(v any) uint64 {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+		panic("riblt: " + err.Error())
+	}
+	return h.Bytes(buf.Bytes())
+}
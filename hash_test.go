@@ -0,0 +1,148 @@
+package riblt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"testing"
+)
+
+var testHashFuncs = []struct {
+	name string
+	f    HashFunc
+}{
+	{"SipHash", SipHash},
+	{"FastHash", FastHash},
+}
+
+func TestSipHash(t *testing.T) {
+	// test vector from the reference implementation of SipHash-2-4
+	k := Key{0x0706050403020100, 0x0f0e0d0c0b0a0908}
+	b := make([]byte, 15)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	if h := SipHash(k, b); h != 0xa129ca6149be45e5 {
+		t.Errorf("got %#x, expected 0xa129ca6149be45e5", h)
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	k := DeriveKey([]byte("secret"), []byte("session"))
+	if k != DeriveKey([]byte("secret"), []byte("session")) {
+		t.Errorf("key derivation is not deterministic")
+	}
+	for _, o := range []Key{
+		DeriveKey([]byte("secret"), []byte("session2")),
+		DeriveKey([]byte("secret2"), []byte("session")),
+		DeriveKey([]byte("secretsession"), nil),
+		DeriveKey(nil, []byte("secretsession")),
+	} {
+		if o == k {
+			t.Errorf("different secrets or sessions derived the same key")
+		}
+	}
+}
+
+// TestHashNotHomomorphic checks the requirement of Symbol.Hash that the hash
+// of the XOR of two source symbols is unrelated to their hashes, and that the
+// hash functions avalanche, for byte strings of the lengths the helpers of
+// Hasher produce and others.
+func TestHashNotHomomorphic(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	k := DeriveKey([]byte("secret"), nil)
+	for _, tc := range testHashFuncs {
+		for _, n := range []int{1, 3, 4, 7, 8, 12, 16, 17, 32, 33, 100} {
+			a := make([]byte, n)
+			b := make([]byte, n)
+			x := make([]byte, n)
+			homomorphic := 0
+			flipped := 0
+			const trials = 1000
+			for i := 0; i < trials; i++ {
+				rng.Read(a)
+				rng.Read(b)
+				for j := range x {
+					x[j] = a[j] ^ b[j]
+				}
+				ha := tc.f(k, a)
+				if tc.f(k, x) == ha^tc.f(k, b) {
+					homomorphic += 1
+				}
+				// flip a random bit of a
+				j := rng.Intn(8 * n)
+				a[j/8] ^= 1 << (j % 8)
+				flipped += bits.OnesCount64(ha ^ tc.f(k, a))
+			}
+			if homomorphic != 0 {
+				t.Errorf("%s: hash of XOR equals XOR of hashes for %d of %d pairs of length %d", tc.name, homomorphic, trials, n)
+			}
+			if avg := float64(flipped) / trials; avg < 30 || avg > 34 {
+				t.Errorf("%s: flipping 1 input bit flips %.1f hash bits on average for length %d, expected 32", tc.name, avg, n)
+			}
+		}
+	}
+}
+
+func TestHasher(t *testing.T) {
+	type record struct {
+		ID    uint64
+		Flags uint16
+		Name  [4]byte
+	}
+	for _, tc := range testHashFuncs {
+		h := Hasher{DeriveKey([]byte("secret"), nil), tc.f}
+		if h.String("hello") != h.Bytes([]byte("hello")) {
+			t.Errorf("%s: String and Bytes disagree", tc.name)
+		}
+		if h.String("") != h.Bytes(nil) {
+			t.Errorf("%s: String and Bytes disagree on the empty string", tc.name)
+		}
+		if h.Uint64(42) != h.Bytes(binary.LittleEndian.AppendUint64(nil, 42)) {
+			t.Errorf("%s: Uint64 and Bytes disagree", tc.name)
+		}
+		r := record{42, 7, [4]byte{'a', 'b', 'c', 'd'}}
+		b := binary.LittleEndian.AppendUint64(nil, 42)
+		b = binary.LittleEndian.AppendUint16(b, 7)
+		b = append(b, "abcd"...)
+		if h.Value(r) != h.Bytes(b) || h.Value(&r) != h.Bytes(b) {
+			t.Errorf("%s: Value and Bytes disagree", tc.name)
+		}
+		if h.Uint64(1) == (Hasher{Func: tc.f}).Uint64(1) {
+			t.Errorf("%s: hash does not depend on the key", tc.name)
+		}
+	}
+	if (Hasher{}).Bytes([]byte("hello")) != SipHash(Key{}, []byte("hello")) {
+		t.Errorf("zero Hasher does not use SipHash")
+	}
+	// a Func that modifies its argument must not modify the string
+	s := "hello"
+	h := Hasher{Func: func(k Key, b []byte) uint64 {
+		b[0] = 'j'
+		return SipHash(k, b)
+	}}
+	if h.String(s); s != "hello" {
+		t.Errorf("String let Func modify the string to %q", s)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Value did not panic on a value that is not fixed-size")
+		}
+	}()
+	Hasher{}.Value(map[int]int{})
+}
+
+func BenchmarkHash(b *testing.B) {
+	for _, tc := range testHashFuncs {
+		for _, n := range []int{8, 64, 1024} {
+			b.Run(fmt.Sprintf("%s/n=%d", tc.name, n), func(b *testing.B) {
+				data := make([]byte, n)
+				b.SetBytes(int64(n))
+				for i := 0; i < b.N; i++ {
+					tc.f(defaultKey, data)
+				}
+			})
+		}
+	}
+}
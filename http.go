@@ -0,0 +1,271 @@
+package riblt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// Handler is an http.Handler that serves the coded symbol sequence of the set
+// maintained by a SketchIndex in ranges, so that a Client can pull as many
+// coded symbols as it needs. A request
+//
+//	GET <path>?from=i&count=n
+//
+// is answered with coded symbols i to i+n-1, each serialized as in
+// Encoder.MarshalBinary, which requires T to implement
+// encoding.BinaryMarshaler. The ETag header of the response is the version of
+// the set. If the request has an If-Match header that does not match the
+// current version, i.e., the set changed since the client's first request,
+// the response is 412 Precondition Failed. A request
+//
+//	GET <path>?fingerprint
+//
+// is answered with the Fingerprint of the set, serialized by its
+// MarshalBinary method, so that the client may skip reconciliation if the
+// sets are equal.
+//
+// Serving a range extends the maintained Sketch to the end of the range, so
+// the Handler only serves coded symbols below an index proportional to the
+// size of the set, which is enough to decode any difference with a set of a
+// similar size, and answers requests beyond it with 416 Requested Range Not
+// Satisfiable.
+type Handler[T Symbol[T]] struct {
+	index *SketchIndex[T]
+	// MaxLength overrides the number of coded symbols served, if positive.
+	// By default, it is 4 times the size of the set, but at least
+	// maxSymbolBatch.
+	MaxLength int
+}
+
+// NewHandler returns a Handler that serves the coded symbols of the set
+// maintained by x.
+func NewHandler[T Symbol[T]](x *SketchIndex[T]) *Handler[T] {
+	return &Handler[T]{index: x}
+}
+
+// maxLength returns the number of coded symbols h serves.
+func (h *Handler[T]) maxLength() int {
+	if h.MaxLength > 0 {
+		return h.MaxLength
+	}
+	return max(4*h.index.Len(), maxSymbolBatch)
+}
+
+// etag returns the ETag of a version of the set.
+func etag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	var b []byte
+	var version uint64
+	if q.Has("fingerprint") {
+		var f Fingerprint
+		f, version = h.index.Fingerprint()
+		b, _ = f.MarshalBinary()
+	} else {
+		from, err1 := strconv.Atoi(q.Get("from"))
+		count, err2 := strconv.Atoi(q.Get("count"))
+		if err1 != nil || err2 != nil || from < 0 || count < 0 || count > maxSymbolBatch {
+			http.Error(w, "invalid range", http.StatusBadRequest)
+			return
+		}
+		// compare without computing from+count, which may overflow
+		if limit := h.maxLength(); from > limit || count > limit-from {
+			http.Error(w, ErrTooManySymbols.Error(), http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		var cs []CodedSymbol[T]
+		cs, version = h.index.Range(from, count)
+		for _, c := range cs {
+			var err error
+			if b, err = appendCodedSymbol(b, c); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	tag := etag(version)
+	w.Header().Set("ETag", tag)
+	if m := r.Header.Get("If-Match"); m != "" && m != tag {
+		http.Error(w, ErrSetChanged.Error(), http.StatusPreconditionFailed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.Write(b)
+}
+
+// Client pulls coded symbols from a Handler. Its zero value is not usable;
+// URL must be set. A Client records the version of the remote set during a
+// session, so it may be used concurrently by the goroutines of one session,
+// e.g., by SyncMulti, but concurrent sessions need separate Clients.
+type Client[T Symbol[T]] struct {
+	// URL of the Handler.
+	URL string
+	// HTTPClient is used to send requests. If nil, http.DefaultClient is
+	// used.
+	HTTPClient *http.Client
+
+	mu  sync.Mutex // protects tag
+	tag string     // ETag of the first response in the session
+}
+
+// Sync pulls coded symbols of the remote set from the Handler, in batches of
+// growing size, and passes them to dec until dec has decoded the symmetric
+// difference. dec must not have received any coded symbol. It first fetches
+// the Fingerprint of the remote set, and returns without passing any coded
+// symbol to dec if it equals the one of the local set. Once dec is decoded,
+// Sync verifies the recovered difference against the Fingerprint, and keeps
+// pulling coded symbols if verification fails. See Decoder.Verify. It gives
+// up and returns ErrFingerprintMismatch if verification still fails after
+// pulling twice as many coded symbols as the sizes of the two sets combined,
+// which is more than enough for any difference between them. If dec
+// has a local source without a Fingerprint, the equality check and the
+// verification are skipped.
+//
+// It returns ErrSetChanged if the remote set changed during the session, in
+// which case the session should be restarted with a reset dec, and
+// ErrTooManySymbols if the Handler refuses to serve as many coded symbols as
+// dec needs. It requires *T to implement encoding.BinaryUnmarshaler.
+func (c *Client[T]) Sync(ctx context.Context, dec *Decoder[T]) error {
+	c.Reset()
+	remote, err := c.Fingerprint(ctx)
+	if err != nil {
+		return err
+	}
+	local, ferr := dec.Fingerprint()
+	if ferr == nil && remote == local {
+		return nil
+	}
+	limit := 2 * (remote.Count + local.Count)
+	// the Fingerprint of the local set is computed once, as dec may turn out
+	// decoded after every coded symbol once verification fails
+	v := verifier[T]{d: dec, f: local}
+	from := 0
+	for batch := minSymbolBatch; ; batch = min(batch*2, maxSymbolBatch) {
+		cs, err := c.CodedSymbols(ctx, from, batch)
+		if err != nil {
+			return err
+		}
+		// keep passing the rest of the batch if verification fails
+		for len(cs) != 0 {
+			n, done := dec.AddCodedSymbolsAt(from, cs)
+			from += n
+			cs = cs[n:]
+			if done && (ferr != nil || v.verify(remote) == nil) {
+				return nil
+			}
+		}
+		if ferr == nil && int64(from) >= limit {
+			return ErrFingerprintMismatch
+		}
+	}
+}
+
+// Fingerprint returns the Fingerprint of the remote set. Like CodedSymbols, it
+// records the version of the remote set on the first call.
+func (c *Client[T]) Fingerprint(ctx context.Context) (Fingerprint, error) {
+	var f Fingerprint
+	body, err := c.get(ctx, url.Values{"fingerprint": {""}})
+	if err != nil {
+		return f, err
+	}
+	return f, f.UnmarshalBinary(body)
+}
+
+// CodedSymbols implements RangeSource. The version of the remote set is
+// recorded on the first call, after which CodedSymbols returns ErrSetChanged
+// if the version changes. Sync and SyncMulti start over by calling Reset.
+func (c *Client[T]) CodedSymbols(ctx context.Context, from, count int) ([]CodedSymbol[T], error) {
+	body, err := c.get(ctx, url.Values{
+		"from":  {strconv.Itoa(from)},
+		"count": {strconv.Itoa(count)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	r := &reader{b: body}
+	cs := make([]CodedSymbol[T], 0, count)
+	for i := 0; i < count && r.err == nil; i++ {
+		cs = append(cs, readCodedSymbol[T](r))
+	}
+	if r.err != nil || len(r.b) != 0 {
+		return nil, ErrMalformed
+	}
+	return cs, nil
+}
+
+// Reset clears the recorded version of the remote set, so that the next call
+// starts a new session.
+func (c *Client[T]) Reset() {
+	c.mu.Lock()
+	c.tag = ""
+	c.mu.Unlock()
+}
+
+// get sends a request with the given query parameters, on the condition that
+// the version of the remote set matches the recorded one, if any, and
+// returns the response body. It records the version of the remote set if
+// none is recorded.
+func (c *Client[T]) get(ctx context.Context, params url.Values) ([]byte, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	tag := c.tag
+	c.mu.Unlock()
+	if tag != "" {
+		req.Header.Set("If-Match", tag)
+	}
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusPreconditionFailed:
+		return nil, ErrSetChanged
+	case http.StatusRequestedRangeNotSatisfiable:
+		return nil, ErrTooManySymbols
+	default:
+		return nil, fmt.Errorf("riblt: unexpected response status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFrameSize+1))
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.tag == "" {
+		c.tag = resp.Header.Get("ETag")
+	}
+	c.mu.Unlock()
+	return body, nil
+}
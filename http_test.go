@@ -0,0 +1,115 @@
+package riblt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newHTTPTestSets returns a SketchIndex of source symbols [0, n), and a
+// Decoder of source symbols [offset, offset+n).
+func newHTTPTestSets(n, offset int) (*SketchIndex[testSymbol], *Decoder[testSymbol]) {
+	x := NewSketchIndex[testSymbol](64, nil)
+	dec := &Decoder[testSymbol]{}
+	for i := 0; i < n; i++ {
+		x.AddSymbol(newTestSymbol(uint64(i)))
+		dec.AddSymbol(newTestSymbol(uint64(i + offset)))
+	}
+	return x, dec
+}
+
+func TestHTTPSync(t *testing.T) {
+	x, dec := newHTTPTestSets(1000, 200)
+	srv := httptest.NewServer(NewHandler(x))
+	defer srv.Close()
+	c := Client[testSymbol]{URL: srv.URL}
+	if err := c.Sync(context.Background(), dec); err != nil {
+		t.Fatal(err)
+	}
+	if len(dec.Remote()) != 200 || len(dec.Local()) != 200 {
+		t.Fatalf("recovered %d remote and %d local symbols, expected 200 and 200", len(dec.Remote()), len(dec.Local()))
+	}
+}
+
+func TestHTTPSetChanged(t *testing.T) {
+	x, dec := newHTTPTestSets(1000, 200)
+	h := NewHandler(x)
+	// change the set after serving the first request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+		x.AddSymbol(newTestSymbol(5000))
+	}))
+	defer srv.Close()
+	c := Client[testSymbol]{URL: srv.URL, HTTPClient: srv.Client()}
+	if err := c.Sync(context.Background(), dec); err != ErrSetChanged {
+		t.Fatalf("got error %v, expected ErrSetChanged", err)
+	}
+}
+
+func TestHTTPHandlerBadRequest(t *testing.T) {
+	h := NewHandler(NewSketchIndex[testSymbol](0, nil))
+	for _, target := range []string{"/", "/?from=0", "/?from=-1&count=1", "/?from=0&count=x", "/?from=0&count=100000000"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("got status %d for %s, expected %d", w.Code, target, http.StatusBadRequest)
+		}
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/?from=0&count=1", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got status %d for POST, expected %d", w.Code, http.StatusMethodNotAllowed)
+	}
+	// ranges far beyond the set must not grow the index
+	for _, target := range []string{"/?from=3000000&count=1", "/?from=9223372036854775807&count=1", "/?from=65536&count=1"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusRequestedRangeNotSatisfiable {
+			t.Errorf("got status %d for %s, expected %d", w.Code, target, http.StatusRequestedRangeNotSatisfiable)
+		}
+	}
+	if n := h.index.length(); n != 0 {
+		t.Errorf("index grew to %d coded symbols", n)
+	}
+}
+
+func TestHTTPSyncEqualSets(t *testing.T) {
+	x, _ := newHTTPTestSets(1000, 0)
+	_, dec := newHTTPTestSets(1000, 0)
+	h := NewHandler(x)
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests += 1
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	c := Client[testSymbol]{URL: srv.URL}
+	if err := c.Sync(context.Background(), dec); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 || len(dec.cs) != 0 || !dec.Decoded() {
+		t.Errorf("sent %d requests and passed %d coded symbols for equal sets, expected 1 and 0", requests, len(dec.cs))
+	}
+}
+
+func TestHTTPSyncVerify(t *testing.T) {
+	// The fingerprints of the sets only differ in Sum, so decoding finishes
+	// right after the first coded symbol, without recovering anything.
+	// Verification fails, so Sync keeps pulling coded symbols.
+	enc, dec := newCollidingEncoderDecoder()
+	x := NewSketchIndex[testSymbol](0, nil)
+	for _, s := range enc.symbols {
+		x.AddHashedSymbol(s)
+	}
+	srv := httptest.NewServer(NewHandler(x))
+	defer srv.Close()
+	c := Client[testSymbol]{URL: srv.URL}
+	if err := c.Sync(context.Background(), dec); err != nil {
+		t.Fatal(err)
+	}
+	n := len(enc.symbols) - 1000
+	if len(dec.Remote()) != n || len(dec.Local()) != n {
+		t.Errorf("recovered %d remote and %d local symbols, expected %d and %d", len(dec.Remote()), len(dec.Local()), n, n)
+	}
+}
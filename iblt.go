@@ -0,0 +1,74 @@
+package riblt
+
+// IBLT is a regular Invertible Bloom Lookup Table with a fixed number of
+// cells, where each source symbol is inserted into K cells, one in each of K
+// equal-sized partitions of the cells. Its cells are the first coded symbols
+// of the sequence defined by IBLTMapping, so it shares the symbol types and the
+// peeling decoder with Rateless IBLTs. Unlike a Sketch, whose length can be
+// chosen by the peer who decodes it, both peers must agree on the number of
+// cells and K beforehand, and decoding fails if the number of cells is too
+// small for the symmetric difference.
+type IBLT[T Symbol[T]] struct {
+	cells   Sketch[T]
+	mapping IBLTMapping
+}
+
+// NewIBLT returns an empty IBLT of the given number of cells, where each
+// source symbol is inserted into k cells. cells must be no less than k, and k
+// must be positive.
+func NewIBLT[T Symbol[T]](cells, k int) *IBLT[T] {
+	if k <= 0 || cells < k {
+		panic("invalid IBLT dimensions")
+	}
+	return &IBLT[T]{
+		cells:   NewSketch[T](cells),
+		mapping: IBLTMapping{Cells: cells, K: k},
+	}
+}
+
+// Cells returns the cells of t. Modifying the returned Sketch modifies t.
+func (t *IBLT[T]) Cells() Sketch[T] {
+	return t.cells
+}
+
+// Mapping returns the Mapping that t uses to map source symbols to its cells.
+func (t *IBLT[T]) Mapping() IBLTMapping {
+	return t.mapping
+}
+
+// Insert inserts source symbol s into t.
+func (t *IBLT[T]) Insert(s T) {
+	t.InsertHashed(HashedSymbol[T]{s, s.Hash()})
+}
+
+// InsertHashed inserts source symbol s into t.
+func (t *IBLT[T]) InsertHashed(s HashedSymbol[T]) {
+	t.cells.AddHashedSymbolWith(s, t.mapping)
+}
+
+// Delete deletes source symbol s from t.
+func (t *IBLT[T]) Delete(s T) {
+	t.DeleteHashed(HashedSymbol[T]{s, s.Hash()})
+}
+
+// DeleteHashed deletes source symbol s from t.
+func (t *IBLT[T]) DeleteHashed(s HashedSymbol[T]) {
+	t.cells.RemoveHashedSymbolWith(s, t.mapping)
+}
+
+// Subtract subtracts t2 from t by modifying t in place. t and t2 must have the
+// same number of cells and K. If t is an IBLT of set S and t2 is an IBLT of
+// set S2, then the result is an IBLT of the symmetric difference between S
+// and S2.
+func (t *IBLT[T]) Subtract(t2 *IBLT[T]) {
+	if t.mapping != t2.mapping {
+		panic("subtracting IBLTs of different dimensions")
+	}
+	t.cells.Subtract(t2.cells)
+}
+
+// Decode tries to decode t. Its results are defined in the same way as
+// Sketch.Decode.
+func (t *IBLT[T]) Decode() (fwd []HashedSymbol[T], rev []HashedSymbol[T], succ bool) {
+	return t.cells.DecodeWith(t.mapping)
+}
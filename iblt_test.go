@@ -0,0 +1,86 @@
+package riblt
+
+import (
+	"testing"
+)
+
+func TestIBLT(t *testing.T) {
+	a := NewIBLT[testSymbol](300, 4)
+	b := NewIBLT[testSymbol](300, 4)
+	var nextId uint64
+	for i := 0; i < 50; i++ {
+		a.Insert(newTestSymbol(nextId))
+		nextId += 1
+	}
+	for i := 0; i < 30; i++ {
+		b.Insert(newTestSymbol(nextId))
+		nextId += 1
+	}
+	for i := 0; i < 1000; i++ {
+		a.Insert(newTestSymbol(nextId))
+		b.Insert(newTestSymbol(nextId))
+		nextId += 1
+	}
+	// insert and then delete a symbol, which should leave no trace
+	b.Insert(newTestSymbol(nextId))
+	b.Delete(newTestSymbol(nextId))
+
+	a.Subtract(b)
+	fwd, rev, succ := a.Decode()
+	if !succ {
+		t.Fatalf("failed to decode")
+	}
+	if len(fwd) != 50 || len(rev) != 30 {
+		t.Errorf("recovered %d forward and %d reverse symbols, expected 50 and 30", len(fwd), len(rev))
+	}
+}
+
+func BenchmarkIBLTEncodeAndDecode(bc *testing.B) {
+	cases := []struct {
+		name string
+		size int
+	}{
+		{"d=10", 10},
+		{"d=100", 100},
+		{"d=1000", 1000},
+		{"d=10000", 10000},
+	}
+	for _, tc := range cases {
+		bc.Run(tc.name, func(b *testing.B) {
+			b.SetBytes(testSymbolSize * int64(tc.size))
+			// size the IBLT such that it decodes with high probability for
+			// large differences
+			ncells := tc.size * 3 / 2
+			if ncells < 16 {
+				ncells = 16
+			}
+			nsucc := 0
+			var nextId uint64
+			b.ResetTimer()
+			for iter := 0; iter < b.N; iter++ {
+				b.StopTimer()
+				alice := NewIBLT[testSymbol](ncells, 4)
+				bob := NewIBLT[testSymbol](ncells, 4)
+				for i := 0; i < tc.size/2; i++ {
+					alice.Insert(newTestSymbol(nextId))
+					nextId += 1
+					bob.Insert(newTestSymbol(nextId))
+					nextId += 1
+				}
+				for i := 0; i < tc.size; i++ {
+					s := newTestSymbol(nextId)
+					nextId += 1
+					alice.Insert(s)
+					bob.Insert(s)
+				}
+				b.StartTimer()
+				alice.Subtract(bob)
+				if _, _, succ := alice.Decode(); succ {
+					nsucc += 1
+				}
+			}
+			b.ReportMetric(float64(ncells)/float64(tc.size), "symbols/diff")
+			b.ReportMetric(float64(nsucc)/float64(b.N), "success")
+		})
+	}
+}
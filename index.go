@@ -0,0 +1,296 @@
+package riblt
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync"
+)
+
+// ErrSetChanged is returned when the set changes in the middle of a session
+// that requires the coded symbol sequence of the set to stay the same.
+var ErrSetChanged = errors.New("riblt: set changed during the session")
+
+// SketchIndex maintains a Sketch of a set that changes over time, so that
+// sessions with peers can start from a snapshot of the Sketch instead of
+// encoding the set from scratch. It keeps the source symbols as well, so that
+// the Sketch can be extended on demand when a peer needs a longer prefix of
+// the coded symbol sequence. It is safe for concurrent use.
+type SketchIndex[T Symbol[T]] struct {
+	mu          sync.RWMutex
+	mapping     Mapping
+	symbols     map[uint64]T // source symbols by hash
+	sketch      Sketch[T]
+	fingerprint Fingerprint
+	version     uint64 // number of changes made to the set
+}
+
+// NewSketchIndex returns a SketchIndex of an empty set, which maintains a
+// Sketch of the given length, and maps source symbols to coded symbols using
+// Mapping g. A nil g stands for RandomMapping.
+func NewSketchIndex[T Symbol[T]](length int, g Mapping) *SketchIndex[T] {
+	return &SketchIndex[T]{
+		mapping: g,
+		symbols: make(map[uint64]T),
+		sketch:  NewSketch[T](length),
+	}
+}
+
+// AddSymbol inserts source symbol s to the set. Like AddHashedSymbol, it
+// returns false if a source symbol of the same hash is already in the set.
+func (x *SketchIndex[T]) AddSymbol(s T) bool {
+	return x.AddHashedSymbol(HashedSymbol[T]{s, s.Hash()})
+}
+
+// AddHashedSymbol inserts source symbol s to the set, and returns true. It
+// does nothing and returns false if a source symbol of the same hash is
+// already in the set, which is either s itself, or a different source symbol
+// whose hash collides with the one of s, see Collision. A SketchIndex cannot
+// hold both source symbols of a Collision, so the caller should rehash the
+// set in the latter case.
+func (x *SketchIndex[T]) AddHashedSymbol(s HashedSymbol[T]) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if _, ok := x.symbols[s.Hash]; ok {
+		return false
+	}
+	x.symbols[s.Hash] = s.Symbol
+	x.sketch.AddHashedSymbolWith(s, x.mapping)
+	x.fingerprint = x.fingerprint.Add(s.Hash)
+	x.version += 1
+	return true
+}
+
+// RemoveSymbol deletes source symbol s from the set. It does nothing if s is
+// not in the set.
+func (x *SketchIndex[T]) RemoveSymbol(s T) {
+	x.RemoveHash(s.Hash())
+}
+
+// RemoveHash deletes the source symbol whose hash is hash from the set. It
+// does nothing if there is no such source symbol.
+func (x *SketchIndex[T]) RemoveHash(hash uint64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	s, ok := x.symbols[hash]
+	if !ok {
+		return
+	}
+	delete(x.symbols, hash)
+	x.sketch.RemoveHashedSymbolWith(HashedSymbol[T]{s, hash}, x.mapping)
+	x.fingerprint = x.fingerprint.Remove(hash)
+	x.version += 1
+}
+
+// Len returns the number of source symbols in the set.
+func (x *SketchIndex[T]) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.symbols)
+}
+
+// Version returns the number of times the set has been changed. Peers may use
+// it to tell whether the set has changed between two snapshots.
+func (x *SketchIndex[T]) Version() uint64 {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.version
+}
+
+// Snapshot returns a copy of the first n coded symbols of the sequence for the
+// set, and the version of the set. It extends the maintained Sketch to length
+// n if it is shorter, so that later snapshots of the same length are cheap.
+func (x *SketchIndex[T]) Snapshot(n int) (Sketch[T], uint64) {
+	return x.Range(0, n)
+}
+
+// Range returns a copy of count coded symbols of the sequence for the set
+// starting from index from, and the version of the set. Like Snapshot, it
+// extends the maintained Sketch to length from+count if it is shorter, but
+// only copies the coded symbols requested. It panics if from or count is
+// negative, or from+count overflows.
+func (x *SketchIndex[T]) Range(from, count int) ([]CodedSymbol[T], uint64) {
+	if from < 0 || count < 0 || from > math.MaxInt-count {
+		panic("invalid range")
+	}
+	x.mu.RLock()
+	if from+count > len(x.sketch) {
+		x.mu.RUnlock()
+		x.Grow(from + count)
+		x.mu.RLock()
+	}
+	defer x.mu.RUnlock()
+	s := make([]CodedSymbol[T], count)
+	copy(s, x.sketch[from:])
+	if isCloner[T]() {
+		for i := range s {
+			s[i].Symbol = cloneSymbol(s[i].Symbol)
+		}
+	}
+	return s, x.version
+}
+
+// Grow extends the maintained Sketch to length n. It does nothing if the
+// Sketch is no shorter than n. It takes time linear to the number of source
+// symbols in the set.
+func (x *SketchIndex[T]) Grow(n int) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	old := len(x.sketch)
+	if n <= old {
+		return
+	}
+	x.sketch = append(x.sketch, NewSketch[T](n-old)...)
+	for h, s := range x.symbols {
+		m := newMapping(x.mapping, h)
+		for m.lastIdx < uint64(old) {
+			m.next(x.mapping)
+		}
+		for int(m.lastIdx) < n {
+			x.sketch[m.lastIdx] = x.sketch[m.lastIdx].apply(HashedSymbol[T]{s, h}, add)
+			m.next(x.mapping)
+		}
+	}
+}
+
+// Source returns a CodedSymbolSource that produces the coded symbol sequence
+// for the set from the maintained Sketch, which is extended when the
+// CodedSymbolSource needs more coded symbols. It allows a Decoder to take the
+// coded symbols of its local set from x. See Decoder.SetLocalSource. If the
+// set changes after Source is called, the coded symbols it produces are
+// invalid starting from the first one that has to be taken from a new
+// snapshot, and its Err method returns ErrSetChanged.
+func (x *SketchIndex[T]) Source() *IndexSource[T] {
+	s, version := x.Snapshot(x.length())
+	return &IndexSource[T]{index: x, sketch: s, version: version}
+}
+
+// length returns the length of the maintained Sketch.
+func (x *SketchIndex[T]) length() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.sketch)
+}
+
+// IndexSource is a CodedSymbolSource that takes coded symbols from a
+// SketchIndex. See SketchIndex.Source.
+type IndexSource[T Symbol[T]] struct {
+	index   *SketchIndex[T]
+	sketch  Sketch[T]
+	next    int
+	version uint64
+	err     error
+}
+
+// ProduceNextCodedSymbol implements CodedSymbolSource.
+func (s *IndexSource[T]) ProduceNextCodedSymbol() CodedSymbol[T] {
+	if s.next == len(s.sketch) {
+		// take a snapshot twice as long, and check that the set has not
+		// changed in between
+		n := 2 * len(s.sketch)
+		if n < 64 {
+			n = 64
+		}
+		var version uint64
+		s.sketch, version = s.index.Snapshot(n)
+		if version != s.version && s.err == nil {
+			s.err = ErrSetChanged
+		}
+	}
+	s.next += 1
+	return s.sketch[s.next-1]
+}
+
+// Fingerprint returns the Fingerprint of the set. If the set has changed since
+// Source was called, Err returns ErrSetChanged afterwards.
+func (s *IndexSource[T]) Fingerprint() Fingerprint {
+	f, version := s.index.Fingerprint()
+	if version != s.version && s.err == nil {
+		s.err = ErrSetChanged
+	}
+	return f
+}
+
+// Err returns ErrSetChanged if the set changed such that some coded symbols s
+// produced are invalid, and nil otherwise.
+func (s *IndexSource[T]) Err() error {
+	return s.err
+}
+
+// version of the serialization format of SketchIndex, which is versioned
+// separately from the states of Encoder and Decoder
+const indexVersion = 1
+
+// MarshalBinary implements encoding.BinaryMarshaler. It serializes the set
+// and the maintained Sketch, but not the Mapping. It requires T to implement
+// encoding.BinaryMarshaler.
+func (x *SketchIndex[T]) MarshalBinary() ([]byte, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	var err error
+	b := []byte{indexVersion}
+	b = binary.AppendUvarint(b, x.version)
+	b = binary.AppendUvarint(b, uint64(len(x.symbols)))
+	for h, s := range x.symbols {
+		if b, err = appendHashedSymbol(b, HashedSymbol[T]{s, h}); err != nil {
+			return nil, err
+		}
+	}
+	b = binary.AppendUvarint(b, uint64(len(x.sketch)))
+	for _, c := range x.sketch {
+		if b, err = appendCodedSymbol(b, c); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It replaces the set
+// and the maintained Sketch with the ones serialized by MarshalBinary, but
+// keeps the Mapping of x. It requires *T to implement
+// encoding.BinaryUnmarshaler. It returns ErrMalformed if the serialized set
+// holds two source symbols of the same hash, or, under RandomMapping and
+// AlphaMapping, if the first coded symbol of the Sketch does not hold the
+// set.
+func (x *SketchIndex[T]) UnmarshalBinary(data []byte) error {
+	r := &reader{b: data}
+	if r.byte() != indexVersion {
+		return ErrMalformed
+	}
+	version := r.uvarint()
+	n := r.length()
+	symbols := make(map[uint64]T, n)
+	var fingerprint Fingerprint
+	for i := 0; i < n && r.err == nil; i++ {
+		s := readHashedSymbol[T](r)
+		if _, ok := symbols[s.Hash]; ok {
+			r.fail(ErrMalformed)
+		}
+		symbols[s.Hash] = s.Symbol
+		fingerprint = fingerprint.Add(s.Hash)
+	}
+	n = r.length()
+	sketch := make(Sketch[T], 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		sketch = append(sketch, readCodedSymbol[T](r))
+	}
+	if r.err == nil && len(r.b) != 0 {
+		r.fail(ErrMalformed)
+	}
+	// the first coded symbol must hold every source symbol, if the Mapping
+	// maps them all to it; checking the rest takes as long as rebuilding
+	if r.err == nil && len(sketch) != 0 && mapsAllToFirst(x.mapping) &&
+		(sketch[0].Count != fingerprint.Count || sketch[0].Hash != fingerprint.Hash) {
+		r.fail(ErrMalformed)
+	}
+	if r.err != nil {
+		return r.err
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.symbols = symbols
+	x.sketch = sketch
+	x.fingerprint = fingerprint
+	x.version = version
+	return nil
+}
@@ -0,0 +1,120 @@
+package riblt
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSketchIndex(t *testing.T) {
+	x := NewSketchIndex[testSymbol](100, nil)
+	for i := 0; i < 1000; i++ {
+		x.AddSymbol(newTestSymbol(uint64(i)))
+	}
+	for i := 0; i < 1000; i += 2 {
+		x.RemoveSymbol(newTestSymbol(uint64(i)))
+	}
+	// adding an existing symbol or removing a missing one changes nothing
+	x.AddSymbol(newTestSymbol(1))
+	x.RemoveSymbol(newTestSymbol(0))
+	if x.Len() != 500 || x.Version() != 1500 {
+		t.Fatalf("set has %d symbols at version %d, expected 500 at version 1500", x.Len(), x.Version())
+	}
+
+	ref := make(Sketch[testSymbol], 300)
+	for i := 1; i < 1000; i += 2 {
+		ref.AddSymbol(newTestSymbol(uint64(i)))
+	}
+	s, version := x.Snapshot(300)
+	if version != 1500 {
+		t.Errorf("snapshot at version %d, expected 1500", version)
+	}
+	for i := range ref {
+		if s[i] != ref[i] {
+			t.Fatalf("coded symbol %d differs from a freshly built Sketch", i)
+		}
+	}
+
+	// snapshots are copies
+	s[0] = CodedSymbol[testSymbol]{}
+	if s2, _ := x.Snapshot(1); s2[0] != ref[0] {
+		t.Errorf("modifying a snapshot modifies the index")
+	}
+
+	data, err := x.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := &SketchIndex[testSymbol]{}
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	restored.AddSymbol(newTestSymbol(0))
+	ref.AddSymbol(newTestSymbol(0))
+	s, version = restored.Snapshot(300)
+	if version != 1501 {
+		t.Errorf("restored index at version %d, expected 1501", version)
+	}
+	for i := range ref {
+		if s[i] != ref[i] {
+			t.Fatalf("coded symbol %d differs after restoring", i)
+		}
+	}
+	if err := restored.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Errorf("accepted truncated data")
+	}
+	// the format has not changed since version 1
+	if err := restored.UnmarshalBinary([]byte{1, 0, 0, 0}); err != nil {
+		t.Errorf("rejected an empty index of version 1: %v", err)
+	}
+}
+
+func TestSketchIndexConcurrent(t *testing.T) {
+	x := NewSketchIndex[testSymbol](10, nil)
+	wg := sync.WaitGroup{}
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				x.AddSymbol(newTestSymbol(uint64(w*1000 + i)))
+				x.Snapshot(10 + i)
+			}
+		}(w)
+	}
+	wg.Wait()
+	ref := make(Sketch[testSymbol], 209)
+	for w := 0; w < 4; w++ {
+		for i := 0; i < 200; i++ {
+			ref.AddSymbol(newTestSymbol(uint64(w*1000 + i)))
+		}
+	}
+	s, _ := x.Snapshot(209)
+	for i := range ref {
+		if s[i] != ref[i] {
+			t.Fatalf("coded symbol %d differs from a freshly built Sketch", i)
+		}
+	}
+}
+
+func TestSketchIndexUnmarshalMalformed(t *testing.T) {
+	s := HashedSymbol[testSymbol]{newTestSymbol(1), newTestSymbol(1).Hash()}
+	header := func(n int) []byte {
+		return []byte{indexVersion, 0, byte(n)}
+	}
+	// a source symbol serialized twice
+	dup := header(2)
+	dup, _ = appendHashedSymbol(dup, s)
+	dup, _ = appendHashedSymbol(dup, s)
+	dup = append(dup, 0)
+	// a Sketch that does not hold the set
+	empty := header(1)
+	empty, _ = appendHashedSymbol(empty, s)
+	empty = append(empty, 1)
+	empty, _ = appendCodedSymbol(empty, emptyCodedSymbol[testSymbol]())
+	for _, data := range [][]byte{dup, empty} {
+		x := NewSketchIndex[testSymbol](0, nil)
+		if err := x.UnmarshalBinary(data); err != ErrMalformed {
+			t.Errorf("got error %v, expected ErrMalformed", err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package riblt
+
+import (
+	"io"
+)
+
+// LazyEncoder is an Encoder for sets too large to keep in memory. It only
+// keeps the hash and the mapping state of each source symbol in memory, and
+// fetches the source symbols from the user when they are needed to produce a
+// coded symbol. Compared to Encoder, it saves the memory for holding the
+// source symbols themselves, at the cost of fetching each source symbol every
+// time it is mapped to a coded symbol.
+type LazyEncoder[T Symbol[T]] struct {
+	hashes   []uint64        // hashes of the source symbols
+	mappings []randomMapping // mapping generators of the source symbols
+	queue    mappingHeap     // priority queue of source symbols by the next coded symbols they are mapped to
+	nextIdx  int             // index of the next coded symbol to be generated
+	mapping  Mapping         // mapping of source symbols to coded symbols, nil for RandomMapping
+	fetch    func(i int) (T, error)
+	err      error // the first error returned by fetch
+}
+
+// NewLazyEncoder returns a LazyEncoder that calls fetch(i) to get the i-th
+// source symbol, counting from 0, in the order they are added by AddHash.
+func NewLazyEncoder[T Symbol[T]](fetch func(i int) (T, error)) *LazyEncoder[T] {
+	return &LazyEncoder[T]{fetch: fetch}
+}
+
+// ReaderAtFetcher returns a function to be passed to NewLazyEncoder, which
+// reads the i-th source symbol from the size bytes at offset i*size of r and
+// deserializes it using the UnmarshalBinary method of *T. The function is safe
+// for concurrent use if r is. Each call reads into a new buffer, which the
+// source symbol may keep.
+func ReaderAtFetcher[T Symbol[T]](r io.ReaderAt, size int) func(i int) (T, error) {
+	return func(i int) (T, error) {
+		t := zeroSymbol[T]()
+		buf := make([]byte, size)
+		// ReadAt may return io.EOF along with the last record in full
+		if n, err := r.ReadAt(buf, int64(i)*int64(size)); n != size {
+			return t, err
+		}
+		return t, unmarshalSymbol(&t, buf)
+	}
+}
+
+// SetMapping sets the Mapping of source symbols to coded symbols used by e. It
+// is the same as Encoder.SetMapping.
+func (e *LazyEncoder[T]) SetMapping(g Mapping) {
+	e.mapping = g
+}
+
+// AddHash adds the next source symbol, whose hash is hash, to e. It is
+// undefined behavior to call AddHash after calling ProduceNextCodedSymbol.
+func (e *LazyEncoder[T]) AddHash(hash uint64) {
+	m := newMapping(e.mapping, hash)
+	e.hashes = append(e.hashes, hash)
+	e.mappings = append(e.mappings, m)
+	e.queue = append(e.queue, symbolMapping{len(e.hashes) - 1, int(m.lastIdx)})
+	e.queue.fixTail()
+}
+
+// ProduceNextCodedSymbol returns the next coded symbol in the sequence. If
+// fetching a source symbol fails, the returned coded symbol and all coded
+// symbols after it are invalid, and Err returns the error.
+func (e *LazyEncoder[T]) ProduceNextCodedSymbol() CodedSymbol[T] {
+	cw := emptyCodedSymbol[T]()
+	for len(e.queue) != 0 && e.queue[0].codedIdx == e.nextIdx {
+		sidx := e.queue[0].sourceIdx
+		s, err := e.fetch(sidx)
+		if err != nil && e.err == nil {
+			e.err = err
+		}
+		cw = cw.apply(HashedSymbol[T]{s, e.hashes[sidx]}, add)
+		e.queue[0].codedIdx = int(e.mappings[sidx].next(e.mapping))
+		e.queue.fixHead()
+	}
+	e.nextIdx += 1
+	return cw
+}
+
+// Err returns the first error returned when fetching source symbols.
+func (e *LazyEncoder[T]) Err() error {
+	return e.err
+}
+
+// Reset clears e, but keeps its Mapping and the function to fetch source
+// symbols.
+func (e *LazyEncoder[T]) Reset() {
+	e.hashes = e.hashes[:0]
+	e.mappings = e.mappings[:0]
+	e.queue = e.queue[:0]
+	e.nextIdx = 0
+	e.err = nil
+}
@@ -0,0 +1,105 @@
+package riblt
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"testing"
+)
+
+func TestLazyEncoder(t *testing.T) {
+	var file []byte
+	enc := Encoder[testSymbol]{}
+	for i := 0; i < 1000; i++ {
+		s := newTestSymbol(uint64(i))
+		enc.AddSymbol(s)
+		file = append(file, s[:]...)
+	}
+	lazy := NewLazyEncoder(ReaderAtFetcher[testSymbol](bytes.NewReader(file), testSymbolSize))
+	for i := 0; i < 1000; i++ {
+		lazy.AddHash(newTestSymbol(uint64(i)).Hash())
+	}
+	for i := 0; i < 2000; i++ {
+		if c1, c2 := enc.ProduceNextCodedSymbol(), lazy.ProduceNextCodedSymbol(); c1 != c2 {
+			t.Fatalf("coded symbol %d differs from Encoder", i)
+		}
+	}
+	if lazy.Err() != nil {
+		t.Fatal(lazy.Err())
+	}
+
+	// a source symbol beyond the end of the file fails to be fetched
+	lazy.Reset()
+	for i := 0; i < 1001; i++ {
+		lazy.AddHash(uint64(i))
+	}
+	lazy.ProduceNextCodedSymbol()
+	if lazy.Err() == nil {
+		t.Errorf("no error when fetching beyond the end of the file")
+	}
+}
+
+// eofReaderAt returns io.EOF along with the last bytes of its data, as
+// io.ReaderAt allows.
+type eofReaderAt struct {
+	*bytes.Reader
+}
+
+func (r eofReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	n, err := r.Reader.ReadAt(b, off)
+	if err == nil && off+int64(n) == r.Size() {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func TestReaderAtFetcherEOF(t *testing.T) {
+	var file []byte
+	for i := 0; i < 2; i++ {
+		s := newTestSymbol(uint64(i))
+		file = append(file, s[:]...)
+	}
+	fetch := ReaderAtFetcher[testSymbol](eofReaderAt{bytes.NewReader(file)}, testSymbolSize)
+	if s, err := fetch(1); err != nil || s != newTestSymbol(1) {
+		t.Errorf("failed to fetch the last source symbol: %v", err)
+	}
+	if _, err := fetch(2); err == nil {
+		t.Errorf("no error when fetching beyond the end of the file")
+	}
+}
+
+// heapInUse returns the number of bytes of the live heap.
+func heapInUse() uint64 {
+	runtime.GC()
+	ms := runtime.MemStats{}
+	runtime.ReadMemStats(&ms)
+	return ms.HeapAlloc
+}
+
+func BenchmarkEncoderMemory(bc *testing.B) {
+	const n = 1000000
+	bc.Run("Encoder", func(b *testing.B) {
+		for iter := 0; iter < b.N; iter++ {
+			before := heapInUse()
+			enc := Encoder[testSymbol]{}
+			for i := 0; i < n; i++ {
+				enc.AddSymbol(newTestSymbol(uint64(i)))
+			}
+			b.ReportMetric(float64(heapInUse()-before)/n, "B/item")
+			runtime.KeepAlive(&enc)
+		}
+	})
+	bc.Run("LazyEncoder", func(b *testing.B) {
+		for iter := 0; iter < b.N; iter++ {
+			before := heapInUse()
+			enc := NewLazyEncoder(func(i int) (testSymbol, error) {
+				return newTestSymbol(uint64(i)), nil
+			})
+			for i := 0; i < n; i++ {
+				enc.AddHash(newTestSymbol(uint64(i)).Hash())
+			}
+			b.ReportMetric(float64(heapInUse()-before)/n, "B/item")
+			runtime.KeepAlive(enc)
+		}
+	})
+}
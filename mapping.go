@@ -2,23 +2,234 @@ package riblt
 
 import (
 	"math"
+	"math/bits"
 )
 
+// Mapping defines how source symbols are mapped to coded symbols. For each
+// source symbol, a Mapping generates a strictly increasing sequence of indices
+// of the coded symbols that the source symbol is mapped to. The sequence must
+// be deterministic, dependent only on the hash of the source symbol, and the
+// encoder and the decoder must use the same Mapping.
+//
+// The generator of a sequence has a state of two uint64s: a PRNG state, whose
+// meaning is up to the Mapping, and the last index in the sequence. A sequence
+// may be finite, in which case Next returns math.MaxInt64 as the index after
+// the last element, and keeps doing so if called again.
+type Mapping interface {
+	// Start returns the initial PRNG state and the first index of the
+	// sequence for a source symbol whose hash is hash.
+	Start(hash uint64) (prng uint64, idx uint64)
+	// Next returns the PRNG state and the index following the given PRNG
+	// state and index.
+	Next(prng uint64, idx uint64) (uint64, uint64)
+}
+
+// PRNG selects the pseudorandom number generator that a built-in Mapping uses
+// to derive the sequence for a source symbol from its hash.
+type PRNG int
+
+const (
+	// MultiplicativePRNG multiplies its state by a constant, and outputs the
+	// new state. It is the PRNG of RandomMapping. It is fast, but sequences
+	// derived from related hashes, e.g., hashes that differ by a small
+	// constant, are correlated, so it relies on the hashes of source symbols
+	// being uniformly random.
+	MultiplicativePRNG PRNG = iota
+	// SplitMix64PRNG is SplitMix64, which adds a constant to its state, and
+	// outputs a bijective mix of the new state. It is slightly slower, but
+	// sequences derived from related hashes are independent.
+	SplitMix64PRNG
+)
+
+// next returns the next state of the PRNG, and the random number it outputs.
+func (p PRNG) next(state uint64) (uint64, uint64) {
+	switch p {
+	case MultiplicativePRNG:
+		r := state * prngMultiplier
+		return r, r
+	case SplitMix64PRNG:
+		state += 0x9e3779b97f4a7c15
+		return state, hashSymbol(state).Hash()
+	default:
+		panic("unknown PRNG")
+	}
+}
+
+// RandomMapping is the default Mapping, used when no Mapping is configured.
+// Every source symbol is mapped to coded symbol 0, and index i is present in
+// the sequence with probability 1/(1+i/2). The sequence ends when the next
+// index would exceed math.MaxInt64.
+type RandomMapping struct{}
+
+// Start implements Mapping.
+func (RandomMapping) Start(hash uint64) (uint64, uint64) {
+	return hash, 0
+}
+
+// Next implements Mapping.
+func (RandomMapping) Next(prng uint64, idx uint64) (uint64, uint64) {
+	m := randomMapping{prng, idx}
+	m.nextIndex()
+	return m.prng, m.lastIdx
+}
+
+// AlphaMapping is a Mapping where every source symbol is mapped to coded
+// symbol 0, and index i is present in the sequence with probability
+// approximately 1/(1+Alpha*i). Alpha must be positive, or Start panics. The
+// sequence ends when the next index would exceed math.MaxInt64. A smaller
+// Alpha maps each source symbol to more coded symbols, which makes encoding
+// and decoding more expensive. For large differences, the number of coded
+// symbols needed to decode is the lowest around Alpha=0.5, and grows quickly
+// as Alpha increases beyond that. AlphaMapping{0.5} defines the same
+// distribution as RandomMapping, though the sequences are not guaranteed to be
+// identical due to floating point rounding. PRNG selects the pseudorandom
+// number generator, and defaults to MultiplicativePRNG, the one RandomMapping
+// uses.
+type AlphaMapping struct {
+	Alpha float64
+	PRNG  PRNG
+}
+
+// Start implements Mapping.
+func (a AlphaMapping) Start(hash uint64) (uint64, uint64) {
+	if !(a.Alpha > 0) {
+		panic("invalid AlphaMapping alpha")
+	}
+	return hash, 0
+}
+
+// Next implements Mapping.
+func (a AlphaMapping) Next(prng uint64, idx uint64) (uint64, uint64) {
+	if idx >= math.MaxInt64 {
+		return prng, math.MaxInt64
+	}
+	prng, r := a.PRNG.next(prng)
+	// The probability that no index in (i, j] is present is
+	//   prod_{k=i+1}^{j} k/(k+1/Alpha),
+	// which is approximately ((i+s)/(j+s))^(1/Alpha) for s = (1+1/Alpha)/2.
+	// Inverting it as in randomMapping.nextIndex gives the difference
+	//   (i+s)((1-u)^(-Alpha)-1).
+	s := (1 + 1/a.Alpha) / 2
+	diff := math.Ceil((float64(idx) + s) * (math.Pow((1<<64)/(float64(r)+1), a.Alpha) - 1))
+	if diff < 1 {
+		diff = 1
+	}
+	return prng, addIndex(idx, diff)
+}
+
+// addIndex returns idx+diff, where idx is at most math.MaxInt64 and diff is at
+// least 1, or math.MaxInt64 if the sum exceeds it or diff is not a number.
+// Converting a float64 out of the range of uint64 is implementation-defined,
+// so we have to check the range before converting.
+func addIndex(idx uint64, diff float64) uint64 {
+	if !(diff < 1<<63) {
+		return math.MaxInt64
+	}
+	next := idx + uint64(diff)
+	if next > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return next
+}
+
+// IBLTMapping is a Mapping that turns the coded symbol sequence into a
+// regular, fixed-size IBLT of Cells coded symbols, where each source symbol is
+// mapped to K of them. The cells are divided into K partitions of Cells/K
+// consecutive cells, and each source symbol is mapped to one cell in each
+// partition. Cells must be no less than K, and K must be positive, or Start
+// and Next panic. Coded symbols at and beyond index K*(Cells/K) are always
+// empty. PRNG selects the pseudorandom number generator, and defaults to
+// MultiplicativePRNG.
+type IBLTMapping struct {
+	Cells int
+	K     int
+	PRNG  PRNG
+}
+
+// Start implements Mapping.
+func (m IBLTMapping) Start(hash uint64) (uint64, uint64) {
+	prng, r := m.PRNG.next(hash)
+	return prng, m.cell(0, r)
+}
+
+// Next implements Mapping.
+func (m IBLTMapping) Next(prng uint64, idx uint64) (uint64, uint64) {
+	part := idx/m.partitionSize() + 1
+	if idx == math.MaxInt64 || part >= uint64(m.K) {
+		return prng, math.MaxInt64
+	}
+	prng, r := m.PRNG.next(prng)
+	return prng, m.cell(part, r)
+}
+
+// partitionSize returns the number of cells in each partition. It panics if
+// the dimensions of m are invalid.
+func (m IBLTMapping) partitionSize() uint64 {
+	if m.K <= 0 || m.Cells < m.K {
+		panic("invalid IBLTMapping dimensions")
+	}
+	return uint64(m.Cells / m.K)
+}
+
+// cell returns the cell in partition part selected by the random number r.
+func (m IBLTMapping) cell(part uint64, r uint64) uint64 {
+	size := m.partitionSize()
+	offset, _ := bits.Mul64(r, size)
+	return part*size + offset
+}
+
+// mapsAllToFirst returns true if Mapping g is known to map every source symbol
+// to coded symbol 0. A nil g stands for RandomMapping.
+func mapsAllToFirst(g Mapping) bool {
+	switch g.(type) {
+	case nil, RandomMapping, AlphaMapping:
+		return true
+	}
+	return false
+}
+
+// prngMultiplier is the multiplier of the multiplicative PRNG used by the
+// built-in mappings.
+const prngMultiplier = 0xda942042e4dd58b5
+
 // randomMapping generates a sequence of indices indicating the coded symbols
 // that a source symbol should be mapped to. The generator is deterministic,
 // dependent only on its initial PRNG state. When seeded with a uniformly
 // random initial PRNG state, index i will be present in the generated sequence
-// with probability 1/(1+i/2), for any non-negative i.
+// with probability 1/(1+i/2), for any non-negative i. It also holds the state
+// of the generators of other Mappings.
 type randomMapping struct {
 	prng    uint64 // PRNG state
 	lastIdx uint64 // the last index the symbol was mapped to
 }
 
+// newMapping returns the generator of the sequence for a source symbol whose
+// hash is hash under Mapping g. A nil g stands for RandomMapping.
+func newMapping(g Mapping, hash uint64) randomMapping {
+	if g == nil {
+		return randomMapping{hash, 0}
+	}
+	prng, idx := g.Start(hash)
+	return randomMapping{prng, idx}
+}
+
+// next returns the next index in the sequence under Mapping g. A nil g stands
+// for RandomMapping.
+func (s *randomMapping) next(g Mapping) uint64 {
+	if g == nil {
+		return s.nextIndex()
+	}
+	s.prng, s.lastIdx = g.Next(s.prng, s.lastIdx)
+	return s.lastIdx
+}
+
 // nextIndex returns the next index in the sequence.
 func (s *randomMapping) nextIndex() uint64 {
-	// Update the PRNG. TODO: prove that the following update rule gives us
-	// high quality randomness, assuming the multiplier is coprime to 2^64.
-	r := s.prng * 0xda942042e4dd58b5
+	// Update the PRNG. mapping_test.go checks statistically that the update
+	// rule gives us the intended distribution for uniformly random initial
+	// states. Sequences from related initial states are correlated, though,
+	// see MultiplicativePRNG.
+	r := s.prng * prngMultiplier
 	s.prng = r
 	// Calculate the difference from the current index (s.lastIdx) to the next
 	// index. See the paper for details. We use the approximated form
@@ -28,6 +239,10 @@ func (s *randomMapping) nextIndex() uint64 {
 	// our u actually comes from sampling a random uint64 r, and then dividing
 	// it by maxUint64, i.e., 1<<64. So we can replace (1-u)^(-1/2) with
 	//   1<<32 / sqrt(r).
-	s.lastIdx += uint64(math.Ceil((float64(s.lastIdx) + 1.5) * ((1<<32)/math.Sqrt(float64(r)+1) - 1)))
+	//
+	// The difference grows with i, so the sequence ends at math.MaxInt64 when
+	// it gets too large, which only happens after a few steps for a few
+	// initial states, e.g., 0, which the PRNG never leaves.
+	s.lastIdx = addIndex(s.lastIdx, math.Ceil((float64(s.lastIdx)+1.5)*((1<<32)/math.Sqrt(float64(r)+1)-1)))
 	return s.lastIdx
 }
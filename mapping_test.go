@@ -1,6 +1,8 @@
 package riblt
 
 import (
+	"fmt"
+	"math"
 	"testing"
 )
 
@@ -11,3 +13,341 @@ func BenchmarkMapping(b *testing.B) {
 		m.nextIndex()
 	}
 }
+
+func TestRandomMapping(t *testing.T) {
+	m := randomMapping{123456789, 0}
+	prng, idx := RandomMapping{}.Start(123456789)
+	for i := 0; i < 1000; i++ {
+		if prng != m.prng || idx != m.lastIdx {
+			t.Fatalf("RandomMapping differs from the built-in mapping at step %d", i)
+		}
+		m.nextIndex()
+		prng, idx = RandomMapping{}.Next(prng, idx)
+	}
+}
+
+func TestAlphaMapping(t *testing.T) {
+	for _, alpha := range []float64{0.25, 0.5, 1, 2} {
+		g := AlphaMapping{Alpha: alpha}
+		// count how many of the sequences contain each index
+		const nseq = 20000
+		const nidx = 64
+		hits := make([]int, nidx)
+		for i := uint64(0); i < nseq; i++ {
+			m := newMapping(g, newTestSymbol(i).Hash())
+			last := m.lastIdx
+			for m.lastIdx < nidx {
+				hits[m.lastIdx] += 1
+				if m.next(g) <= last {
+					t.Fatalf("alpha=%v: sequence not strictly increasing", alpha)
+				}
+				last = m.lastIdx
+			}
+		}
+		if hits[0] != nseq {
+			t.Errorf("alpha=%v: %d sequences do not contain index 0", alpha, nseq-hits[0])
+		}
+		for i := 1; i < nidx; i++ {
+			p := float64(hits[i]) / nseq
+			exp := 1 / (1 + alpha*float64(i))
+			if math.Abs(p-exp) > 0.1*exp+0.01 {
+				t.Errorf("alpha=%v: index %d present with probability %.3f, expected %.3f", alpha, i, p, exp)
+			}
+		}
+	}
+}
+
+func TestIBLTMapping(t *testing.T) {
+	g := IBLTMapping{Cells: 100, K: 4}
+	for i := uint64(0); i < 1000; i++ {
+		m := newMapping(g, newTestSymbol(i).Hash())
+		for part := 0; part < 4; part++ {
+			if int(m.lastIdx)/25 != part {
+				t.Fatalf("index %d is not in partition %d", m.lastIdx, part)
+			}
+			m.next(g)
+		}
+		if m.lastIdx != math.MaxInt64 || m.next(g) != math.MaxInt64 {
+			t.Fatalf("sequence does not end after %d indices", 4)
+		}
+	}
+}
+
+func TestMappingRange(t *testing.T) {
+	// With a large Alpha, indices grow quickly and would overflow if not
+	// clamped.
+	g := AlphaMapping{Alpha: 4}
+	for i := uint64(0); i < 200000; i++ {
+		m := newMapping(g, newTestSymbol(i).Hash())
+		for m.lastIdx != math.MaxInt64 {
+			last := m.lastIdx
+			if m.next(g) <= last || m.lastIdx > math.MaxInt64 {
+				t.Fatalf("index %d follows index %d", m.lastIdx, last)
+			}
+		}
+		if m.next(g) != math.MaxInt64 {
+			t.Fatalf("sequence does not end at math.MaxInt64")
+		}
+	}
+	s := NewSketch[testSymbol](100)
+	s.AddHashedSymbolWith(HashedSymbol[testSymbol]{newTestSymbol(0), 0}, g)
+
+	for _, g := range []Mapping{
+		AlphaMapping{},
+		AlphaMapping{Alpha: math.NaN()},
+		IBLTMapping{Cells: 3, K: 4},
+		IBLTMapping{Cells: 4},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%v did not panic", g)
+				}
+			}()
+			newMapping(g, 1)
+		}()
+	}
+}
+
+func TestRandomMappingEnds(t *testing.T) {
+	// The PRNG never leaves state 0, so the differences between indices
+	// grow geometrically, and the sequence ends after a few steps.
+	m := newMapping(nil, 0)
+	for i := 0; m.lastIdx != math.MaxInt64; i++ {
+		last := m.lastIdx
+		if i > 10 || m.next(nil) <= last || m.lastIdx > math.MaxInt64 {
+			t.Fatalf("index %d follows index %d", m.lastIdx, last)
+		}
+	}
+	if m.next(nil) != math.MaxInt64 {
+		t.Fatalf("sequence does not end at math.MaxInt64")
+	}
+}
+
+func TestEncodeAndDecodeWithMapping(t *testing.T) {
+	mappings := []struct {
+		name    string
+		mapping Mapping
+	}{
+		{"random", RandomMapping{}},
+		{"alpha=0.25", AlphaMapping{Alpha: 0.25}},
+		{"alpha=1", AlphaMapping{Alpha: 1}},
+		{"iblt", IBLTMapping{Cells: 1000, K: 4}},
+	}
+	for _, tc := range mappings {
+		t.Run(tc.name, func(t *testing.T) {
+			enc := Encoder[testSymbol]{}
+			dec := Decoder[testSymbol]{}
+			enc.SetMapping(tc.mapping)
+			dec.SetMapping(tc.mapping)
+			var nextId uint64
+			for i := 0; i < 100; i++ {
+				dec.AddSymbol(newTestSymbol(nextId))
+				nextId += 1
+				enc.AddSymbol(newTestSymbol(nextId))
+				nextId += 1
+			}
+			for i := 0; i < 1000; i++ {
+				enc.AddSymbol(newTestSymbol(nextId))
+				dec.AddSymbol(newTestSymbol(nextId))
+				nextId += 1
+			}
+			for i := 0; i < 2000; i++ {
+				dec.AddCodedSymbol(enc.ProduceNextCodedSymbol())
+			}
+			dec.TryDecode()
+			if !dec.Decoded() || len(dec.Remote()) != 100 || len(dec.Local()) != 100 {
+				t.Errorf("failed to decode: %d remote and %d local symbols recovered", len(dec.Remote()), len(dec.Local()))
+			}
+		})
+	}
+}
+
+func BenchmarkEncodeAndDecodeWithAlpha(bc *testing.B) {
+	for _, alpha := range []float64{0.25, 0.5, 1} {
+		for _, size := range []int{10, 1000} {
+			bc.Run(fmt.Sprintf("alpha=%v/d=%d", alpha, size), func(b *testing.B) {
+				g := AlphaMapping{Alpha: alpha}
+				ncw := 0
+				var nextId uint64
+				for iter := 0; iter < b.N; iter++ {
+					b.StopTimer()
+					enc := Encoder[testSymbol]{}
+					dec := Decoder[testSymbol]{}
+					enc.SetMapping(g)
+					dec.SetMapping(g)
+					for i := 0; i < size; i++ {
+						enc.AddSymbol(newTestSymbol(nextId))
+						nextId += 1
+					}
+					for i := 0; i < size; i++ {
+						s := newTestSymbol(nextId)
+						nextId += 1
+						enc.AddSymbol(s)
+						dec.AddSymbol(s)
+					}
+					b.StartTimer()
+					for {
+						dec.AddCodedSymbol(enc.ProduceNextCodedSymbol())
+						dec.TryDecode()
+						ncw += 1
+						if dec.Decoded() {
+							break
+						}
+					}
+				}
+				b.ReportMetric(float64(ncw)/float64(b.N*size), "symbols/diff")
+			})
+		}
+	}
+}
+
+// statMappings are the mappings whose statistical properties we check. They
+// all define the same distribution as RandomMapping.
+var statMappings = []struct {
+	name    string
+	mapping Mapping
+}{
+	{"multiplicative", nil},
+	{"splitmix64", AlphaMapping{Alpha: 0.5, PRNG: SplitMix64PRNG}},
+}
+
+// inclusionProbability is the probability that index i is present in a
+// sequence generated by RandomMapping.
+func inclusionProbability(i int) float64 {
+	return 1 / (1 + float64(i)/2)
+}
+
+// approximationError bounds the deviation of the actual inclusion probability
+// of index i from inclusionProbability(i), which comes from the continuous
+// approximation randomMapping.nextIndex uses. It is largest for small i.
+func approximationError(i int) float64 {
+	return 0.12 / float64((i+1)*(i+1))
+}
+
+func TestMappingInclusionProbability(t *testing.T) {
+	const nseq = 100000
+	const nidx = 256
+	for _, tc := range statMappings {
+		t.Run(tc.name, func(t *testing.T) {
+			hits := make([]int, nidx)
+			for i := uint64(0); i < nseq; i++ {
+				m := newMapping(tc.mapping, newTestSymbol(i).Hash())
+				for m.lastIdx < nidx {
+					hits[m.lastIdx] += 1
+					m.next(tc.mapping)
+				}
+			}
+			for i := 0; i < nidx; i++ {
+				p := inclusionProbability(i)
+				sd := math.Sqrt(p * (1 - p) / nseq)
+				if dev := math.Abs(float64(hits[i])/nseq - p); dev > 5*sd+approximationError(i) {
+					t.Errorf("index %d present with probability %.4f, expected %.4f", i, float64(hits[i])/nseq, p)
+				}
+			}
+		})
+	}
+}
+
+// cooccurrence returns the largest z-score of the number of times two
+// sequences, generated from seeds s and seed(s), both contain an index, with
+// respect to the number expected if they were independent.
+func cooccurrence(g Mapping, seed func(uint64) uint64) float64 {
+	const npair = 100000
+	const nidx = 64
+	both := make([]int, nidx)
+	single := make([]int, nidx)
+	for i := uint64(0); i < npair; i++ {
+		s := newTestSymbol(i).Hash()
+		in := make([]bool, nidx)
+		m := newMapping(g, s)
+		for m.lastIdx < nidx {
+			in[m.lastIdx] = true
+			single[m.lastIdx] += 1
+			m.next(g)
+		}
+		m = newMapping(g, seed(s))
+		for m.lastIdx < nidx {
+			if in[m.lastIdx] {
+				both[m.lastIdx] += 1
+			}
+			m.next(g)
+		}
+	}
+	worst := 0.0
+	// index 0 is always present
+	for i := 1; i < nidx; i++ {
+		p := float64(single[i]) / npair
+		exp := npair * p * p
+		z := math.Abs(float64(both[i])-exp) / math.Sqrt(exp*(1-p*p))
+		worst = math.Max(worst, z)
+	}
+	return worst
+}
+
+func TestMappingIndependence(t *testing.T) {
+	random := func(s uint64) uint64 {
+		return hashSymbol(s).Hash()
+	}
+	adjacent := func(s uint64) uint64 {
+		return s + 1
+	}
+	for _, tc := range statMappings {
+		if z := cooccurrence(tc.mapping, random); z > 5 {
+			t.Errorf("%s: sequences from independent seeds are correlated, z-score %.1f", tc.name, z)
+		}
+	}
+	// only SplitMix64 is expected to produce independent sequences from
+	// related seeds
+	if z := cooccurrence(AlphaMapping{Alpha: 0.5, PRNG: SplitMix64PRNG}, adjacent); z > 5 {
+		t.Errorf("splitmix64: sequences from adjacent seeds are correlated, z-score %.1f", z)
+	}
+	t.Logf("multiplicative: z-score of sequences from adjacent seeds %.1f", cooccurrence(nil, adjacent))
+}
+
+func TestCodedSymbolDegree(t *testing.T) {
+	const nsym = 2000
+	const nidx = 520
+	for _, tc := range statMappings {
+		t.Run(tc.name, func(t *testing.T) {
+			degree := make([]int, nidx)
+			for i := uint64(0); i < nsym; i++ {
+				m := newMapping(tc.mapping, newTestSymbol(i).Hash())
+				for m.lastIdx < nidx {
+					degree[m.lastIdx] += 1
+					m.next(tc.mapping)
+				}
+			}
+			if degree[0] != nsym {
+				t.Errorf("coded symbol 0 has degree %d, expected %d", degree[0], nsym)
+			}
+			// The degree of coded symbol i follows the binomial distribution
+			// of nsym trials with success probability p_i, so its z-score
+			// has mean 0 and variance 1. Skip small indices, where the
+			// approximation error is comparable to the standard deviation.
+			sum, sumsq := 0.0, 0.0
+			for i := 8; i < nidx; i++ {
+				p := inclusionProbability(i)
+				z := (float64(degree[i]) - nsym*p) / math.Sqrt(nsym*p*(1-p))
+				sum += z
+				sumsq += z * z
+			}
+			n := float64(nidx - 8)
+			if mean := sum / n; math.Abs(mean) > 0.25 {
+				t.Errorf("mean z-score of degrees is %.3f, expected 0", mean)
+			}
+			if v := sumsq / n; v < 0.75 || v > 1.3 {
+				t.Errorf("mean squared z-score of degrees is %.3f, expected 1", v)
+			}
+		})
+	}
+}
+
+func BenchmarkMappingSplitMix64(b *testing.B) {
+	g := AlphaMapping{Alpha: 0.5, PRNG: SplitMix64PRNG}
+	m := newMapping(g, 123456789)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.next(g)
+	}
+}
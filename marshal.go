@@ -0,0 +1,376 @@
+package riblt
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Source symbols are serialized using their MarshalBinary method, and
+// deserialized using the UnmarshalBinary method of their pointers, so
+// serializing any state that contains source symbols of type T requires T to
+// implement encoding.BinaryMarshaler and *T to implement
+// encoding.BinaryUnmarshaler. If T is a pointer type that implements Zeroer,
+// T may implement encoding.BinaryUnmarshaler instead of *T, and source
+// symbols are deserialized into values returned by Zero.
+var (
+	// ErrNotMarshalable is returned when serializing or deserializing source
+	// symbols that do not implement encoding.BinaryMarshaler or
+	// encoding.BinaryUnmarshaler.
+	ErrNotMarshalable = errors.New("riblt: source symbol does not implement encoding.BinaryMarshaler and encoding.BinaryUnmarshaler")
+	// ErrMalformed is returned when deserializing malformed data.
+	ErrMalformed = errors.New("riblt: malformed data")
+)
+
+// version of the serialization format of Encoder and Decoder states. Version
+// 2 added the coded symbols missing from a Decoder.
+const stateVersion = 2
+
+// appendSymbol appends t prefixed by its length to b.
+func appendSymbol[T any](b []byte, t T) ([]byte, error) {
+	m, ok := any(t).(encoding.BinaryMarshaler)
+	if !ok {
+		return b, ErrNotMarshalable
+	}
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return b, err
+	}
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...), nil
+}
+
+// appendHashedSymbol appends t to b.
+func appendHashedSymbol[T Symbol[T]](b []byte, t HashedSymbol[T]) ([]byte, error) {
+	b, err := appendSymbol(b, t.Symbol)
+	return binary.LittleEndian.AppendUint64(b, t.Hash), err
+}
+
+// appendCodedSymbol appends c to b.
+func appendCodedSymbol[T Symbol[T]](b []byte, c CodedSymbol[T]) ([]byte, error) {
+	b, err := appendHashedSymbol(b, c.HashedSymbol)
+	return binary.AppendVarint(b, c.Count), err
+}
+
+// reader parses data produced by the append functions. Once an error is
+// encountered, it is kept in err and all subsequent reads return zero values.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+	r.b = nil
+}
+
+func (r *reader) byte() byte {
+	if len(r.b) < 1 {
+		r.fail(ErrMalformed)
+		return 0
+	}
+	v := r.b[0]
+	r.b = r.b[1:]
+	return v
+}
+
+func (r *reader) uint64() uint64 {
+	if len(r.b) < 8 {
+		r.fail(ErrMalformed)
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(r.b)
+	r.b = r.b[8:]
+	return v
+}
+
+func (r *reader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.fail(ErrMalformed)
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *reader) varint() int64 {
+	v, n := binary.Varint(r.b)
+	if n <= 0 {
+		r.fail(ErrMalformed)
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+// length reads a uvarint that is the number of items to follow, each of which
+// takes at least one byte, so that a malformed length does not cause a huge
+// allocation.
+func (r *reader) length() int {
+	v := r.uvarint()
+	if v > uint64(len(r.b)) {
+		r.fail(ErrMalformed)
+		return 0
+	}
+	return int(v)
+}
+
+func (r *reader) bytes(n int) []byte {
+	if len(r.b) < n {
+		r.fail(ErrMalformed)
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+// appendBits appends v to b, one bit per item.
+func appendBits(b []byte, v []bool) []byte {
+	for i := 0; i < len(v); i += 8 {
+		var bits byte
+		for j := 0; j < 8 && i+j < len(v); j++ {
+			if v[i+j] {
+				bits |= 1 << j
+			}
+		}
+		b = append(b, bits)
+	}
+	return b
+}
+
+// bits reads n items written by appendBits and appends them to v.
+func (r *reader) bits(v []bool, n int) []bool {
+	bits := r.bytes((n + 7) / 8)
+	for i := 0; i < n && r.err == nil; i++ {
+		v = append(v, bits[i/8]&(1<<(i%8)) != 0)
+	}
+	return v
+}
+
+// readSymbol reads a source symbol written by appendSymbol.
+func readSymbol[T any](r *reader) T {
+	t := zeroSymbol[T]()
+	data := r.bytes(r.length())
+	if r.err != nil {
+		return t
+	}
+	if err := unmarshalSymbol(&t, data); err != nil {
+		r.fail(err)
+	}
+	return t
+}
+
+// unmarshalSymbol deserializes data into *t. It uses the UnmarshalBinary
+// method of *T, or of T if T is a pointer type implementing Zeroer, in which
+// case *t must have been initialized to e.
+func unmarshalSymbol[T any](t *T, data []byte) error {
+	if u, ok := any(t).(encoding.BinaryUnmarshaler); ok {
+		return u.UnmarshalBinary(data)
+	}
+	if u, ok := any(*t).(encoding.BinaryUnmarshaler); ok && isZeroer[T]() {
+		return u.UnmarshalBinary(data)
+	}
+	return ErrNotMarshalable
+}
+
+// readHashedSymbol reads a HashedSymbol written by appendHashedSymbol.
+func readHashedSymbol[T Symbol[T]](r *reader) HashedSymbol[T] {
+	s := readSymbol[T](r)
+	return HashedSymbol[T]{s, r.uint64()}
+}
+
+// readCodedSymbol reads a CodedSymbol written by appendCodedSymbol.
+func readCodedSymbol[T Symbol[T]](r *reader) CodedSymbol[T] {
+	s := readHashedSymbol[T](r)
+	return CodedSymbol[T]{s, r.varint()}
+}
+
+// appendBinary appends the state of e, except for its Mapping, to b.
+func (e *codingWindow[T]) appendBinary(b []byte) ([]byte, error) {
+	var err error
+	b = binary.AppendUvarint(b, uint64(len(e.symbols)))
+	for i := range e.symbols {
+		b, err = appendHashedSymbol(b, e.symbols[i])
+		if err != nil {
+			return b, err
+		}
+		b = binary.LittleEndian.AppendUint64(b, e.mappings[i].prng)
+		b = binary.AppendUvarint(b, e.mappings[i].lastIdx)
+	}
+	// The coded index of each queue item is the last index of the mapping
+	// of the source symbol, so we only store the order of the source symbols
+	// in the heap.
+	for _, q := range e.queue {
+		b = binary.AppendUvarint(b, uint64(q.sourceIdx))
+	}
+	b = binary.AppendUvarint(b, uint64(e.nextIdx))
+	return b, nil
+}
+
+// readBinary replaces the state of e, except for its Mapping, with the one
+// written by appendBinary. It fails unless the queue is a heap of every source
+// symbol, ordered by indices no less than the index of the next coded symbol,
+// so that e does not skip or revisit coded symbols.
+func (e *codingWindow[T]) readBinary(r *reader) {
+	e.reset()
+	n := r.length()
+	for i := 0; i < n && r.err == nil; i++ {
+		e.symbols = append(e.symbols, readHashedSymbol[T](r))
+		if e.detector != nil {
+			e.detector.Add(e.symbols[i])
+		}
+		e.mappings = append(e.mappings, randomMapping{r.uint64(), r.uvarint()})
+	}
+	queued := make([]bool, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		sidx := r.uvarint()
+		if sidx >= uint64(n) || queued[sidx] || e.mappings[sidx].lastIdx > math.MaxInt64 {
+			r.fail(ErrMalformed)
+			break
+		}
+		queued[sidx] = true
+		e.queue = append(e.queue, symbolMapping{int(sidx), int(e.mappings[sidx].lastIdx)})
+		if e.queue[(i-1)/2].codedIdx > e.queue[i].codedIdx {
+			r.fail(ErrMalformed)
+		}
+	}
+	next := r.uvarint()
+	if next > math.MaxInt64 || (len(e.queue) != 0 && uint64(e.queue[0].codedIdx) < next) {
+		r.fail(ErrMalformed)
+	}
+	e.nextIdx = int(next)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. It serializes the state
+// of e, except for its Mapping, including the index of the next coded symbol,
+// so that the sender can resume producing coded symbols from the same index
+// by calling UnmarshalBinary on an Encoder with the same Mapping. It requires
+// T to implement encoding.BinaryMarshaler.
+func (e *Encoder[T]) MarshalBinary() ([]byte, error) {
+	return (*codingWindow[T])(e).appendBinary([]byte{stateVersion})
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It replaces the state
+// of e with the one serialized by MarshalBinary, but keeps the Mapping of e.
+// It requires *T to implement encoding.BinaryUnmarshaler.
+func (e *Encoder[T]) UnmarshalBinary(data []byte) error {
+	r := &reader{b: data}
+	if r.byte() != stateVersion {
+		return ErrMalformed
+	}
+	(*codingWindow[T])(e).readBinary(r)
+	if r.err == nil && len(r.b) != 0 {
+		r.fail(ErrMalformed)
+	}
+	if r.err != nil {
+		e.Reset()
+		return r.err
+	}
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. It serializes the state
+// of d, except for its Mapping, so that a decoding session can be resumed
+// later by calling UnmarshalBinary on a Decoder with the same Mapping. It
+// requires T to implement encoding.BinaryMarshaler. The local source set by
+// SetLocalSource is not serialized. To resume, restore the source to the same
+// position, e.g., using Encoder.UnmarshalBinary, and set it again after
+// calling UnmarshalBinary.
+func (d *Decoder[T]) MarshalBinary() ([]byte, error) {
+	var err error
+	b := []byte{stateVersion}
+	b = binary.AppendUvarint(b, uint64(len(d.cs)))
+	for _, c := range d.cs {
+		if b, err = appendCodedSymbol(b, c); err != nil {
+			return nil, err
+		}
+	}
+	for _, w := range []*codingWindow[T]{&d.window, &d.remote, &d.local} {
+		if b, err = w.appendBinary(b); err != nil {
+			return nil, err
+		}
+	}
+	b = binary.AppendUvarint(b, uint64(len(d.decodable)))
+	for _, idx := range d.decodable {
+		b = binary.AppendUvarint(b, uint64(idx))
+	}
+	b = appendBits(b, d.visited)
+	b = appendBits(b, d.missing)
+	b = binary.AppendUvarint(b, uint64(d.decoded))
+	b = binary.AppendUvarint(b, uint64(d.peels))
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It replaces the state
+// of d with the one serialized by MarshalBinary, but keeps the Mapping of d.
+// It requires *T to implement encoding.BinaryUnmarshaler.
+func (d *Decoder[T]) UnmarshalBinary(data []byte) error {
+	r := &reader{b: data}
+	if r.byte() != stateVersion {
+		return ErrMalformed
+	}
+	d.Reset()
+	n := r.length()
+	for i := 0; i < n && r.err == nil; i++ {
+		d.cs = append(d.cs, readCodedSymbol[T](r))
+	}
+	for _, w := range []*codingWindow[T]{&d.window, &d.remote, &d.local} {
+		w.readBinary(r)
+	}
+	n = r.length()
+	for i := 0; i < n && r.err == nil; i++ {
+		idx := r.uvarint()
+		if idx >= uint64(len(d.cs)) {
+			r.fail(ErrMalformed)
+		}
+		d.decodable = append(d.decodable, int(idx))
+	}
+	d.visited = r.bits(d.visited, len(d.cs))
+	d.missing = r.bits(d.missing, len(d.cs))
+	// every coded symbol visited is decoded exactly once, and missing ones
+	// are never visited
+	nvisited := 0
+	for i := 0; i < len(d.cs) && r.err == nil; i++ {
+		if d.visited[i] {
+			nvisited += 1
+		}
+		if d.missing[i] {
+			d.nmissing += 1
+		}
+		if d.visited[i] && d.missing[i] {
+			r.fail(ErrMalformed)
+		}
+	}
+	if r.uvarint() != uint64(nvisited) {
+		r.fail(ErrMalformed)
+	}
+	d.decoded = nvisited
+	d.peels = int(r.uvarint())
+	// the windows must have been applied to every coded symbol
+	for _, w := range []*codingWindow[T]{&d.window, &d.remote, &d.local} {
+		if w.nextIdx != len(d.cs) {
+			r.fail(ErrMalformed)
+		}
+	}
+	if d.window.detector != nil {
+		for _, s := range d.remote.symbols {
+			d.window.detector.check(s)
+		}
+		if r.err == nil {
+			d.findConflicts()
+		}
+	}
+	if r.err == nil && len(r.b) != 0 {
+		r.fail(ErrMalformed)
+	}
+	if r.err != nil {
+		d.Reset()
+		return r.err
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package riblt
+
+import (
+	"testing"
+)
+
+type unmarshalableSymbol uint64
+
+func (d unmarshalableSymbol) XOR(t2 unmarshalableSymbol) unmarshalableSymbol {
+	return d ^ t2
+}
+
+func (d unmarshalableSymbol) Hash() uint64 {
+	return uint64(d) * 0x9e3779b97f4a7c15
+}
+
+func TestDecoderMarshal(t *testing.T) {
+	enc := Encoder[testSymbol]{}
+	dec := Decoder[testSymbol]{}
+	var nextId uint64
+	for i := 0; i < 500; i++ {
+		dec.AddSymbol(newTestSymbol(nextId))
+		nextId += 1
+		enc.AddSymbol(newTestSymbol(nextId))
+		nextId += 1
+	}
+	for i := 0; i < 1000; i++ {
+		enc.AddSymbol(newTestSymbol(nextId))
+		dec.AddSymbol(newTestSymbol(nextId))
+		nextId += 1
+	}
+	var cs []CodedSymbol[testSymbol]
+	for i := 0; i < 2000; i++ {
+		cs = append(cs, enc.ProduceNextCodedSymbol())
+	}
+
+	// decode part of the sequence, leaving some decodable symbols unpeeled
+	dec.AddCodedSymbols(cs[:700])
+	dec.AddCodedSymbol(cs[700])
+	data, err := dec.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := Decoder[testSymbol]{}
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Stats() != dec.Stats() {
+		t.Fatalf("restored decoder has stats %+v, expected %+v", restored.Stats(), dec.Stats())
+	}
+
+	n1, done1 := dec.AddCodedSymbols(cs[701:])
+	n2, done2 := restored.AddCodedSymbols(cs[701:])
+	if !done1 || !done2 || n1 != n2 {
+		t.Fatalf("restored decoder finished after %d coded symbols (%v), expected %d (%v)", n2, done2, n1, done1)
+	}
+	for i, s := range dec.Remote() {
+		if restored.Remote()[i] != s {
+			t.Fatalf("remote symbol %d differs", i)
+		}
+	}
+	for i, s := range dec.Local() {
+		if restored.Local()[i] != s {
+			t.Fatalf("local symbol %d differs", i)
+		}
+	}
+
+	// truncated input must be rejected
+	for _, n := range []int{0, 1, len(data) / 2, len(data) - 1} {
+		if err := restored.UnmarshalBinary(data[:n]); err == nil {
+			t.Errorf("accepted data truncated to %d bytes", n)
+		}
+	}
+	// so must data of another version
+	old := append([]byte{1}, data[1:]...)
+	if err := restored.UnmarshalBinary(old); err != ErrMalformed {
+		t.Errorf("accepted data of version 1")
+	}
+}
+
+func TestDecoderMarshalUnsupported(t *testing.T) {
+	dec := Decoder[unmarshalableSymbol]{}
+	dec.AddSymbol(1)
+	if _, err := dec.MarshalBinary(); err != ErrNotMarshalable {
+		t.Errorf("expected ErrNotMarshalable, got %v", err)
+	}
+}
+
+func TestEncoderMarshal(t *testing.T) {
+	enc := Encoder[testSymbol]{}
+	for i := 0; i < 1000; i++ {
+		enc.AddSymbol(newTestSymbol(uint64(i)))
+	}
+	for i := 0; i < 500; i++ {
+		enc.ProduceNextCodedSymbol()
+	}
+	data, err := enc.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := Encoder[testSymbol]{}
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500; i++ {
+		if c1, c2 := enc.ProduceNextCodedSymbol(), restored.ProduceNextCodedSymbol(); c1 != c2 {
+			t.Fatalf("coded symbol %d differs after restoring", 500+i)
+		}
+	}
+
+	for _, n := range []int{0, 1, len(data) / 2, len(data) - 1} {
+		if err := restored.UnmarshalBinary(data[:n]); err == nil {
+			t.Errorf("accepted data truncated to %d bytes", n)
+		}
+	}
+}
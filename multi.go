@@ -0,0 +1,131 @@
+package riblt
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrInconsistentSources is returned when sources that are supposed to hold
+// the same set produce different coded symbols.
+var ErrInconsistentSources = errors.New("riblt: sources disagree on the coded symbol sequence")
+
+// RangeSource provides random access to the coded symbol sequence of a set,
+// e.g., a Client pulling from a remote Handler. A RangeSource that records
+// state across calls of a session, like the version of the remote set that a
+// Client records, may implement Reset to start over, which SyncMulti calls on
+// every source before fetching any coded symbol.
+type RangeSource[T Symbol[T]] interface {
+	// CodedSymbols returns count coded symbols of the sequence starting from
+	// index from.
+	CodedSymbols(ctx context.Context, from, count int) ([]CodedSymbol[T], error)
+}
+
+// SyncMulti is like Client.Sync, but pulls coded symbols from several sources
+// holding the same set, e.g., replicas, so that a large difference is
+// reconciled faster. Each source is used by one goroutine at a time. The
+// goroutines take disjoint ranges of the sequence in turn, and pass them to
+// dec as they arrive, so ranges are passed out of order. See
+// Decoder.AddCodedSymbolsAt. Ranges grow as more coded symbols are fetched,
+// so that the number of requests is logarithmic in the size of the
+// difference.
+//
+// To spot-check that the sources agree, each range after the first one starts
+// one coded symbol early, overlapping the previous range, which is likely
+// fetched from a different source. The hash and the count of the overlapping
+// coded symbols must match, or SyncMulti returns ErrInconsistentSources. A
+// source symbol in the difference between the sources goes unnoticed if it
+// is not mapped to any overlapping coded symbol, so small differences are
+// likely missed, in which case decoding still succeeds if the coded symbols
+// are consistent enough, but may recover wrong source symbols. It returns the
+// first error any source returns, after which dec must be reset before
+// starting over.
+func SyncMulti[T Symbol[T]](ctx context.Context, dec *Decoder[T], sources ...RangeSource[T]) error {
+	if len(sources) == 0 {
+		return errors.New("riblt: no source")
+	}
+	for _, src := range sources {
+		if r, ok := src.(interface{ Reset() }); ok {
+			r.Reset()
+		}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	next := 0
+	done := false
+	var err error
+	// the first coded symbol of each range, and the last coded symbol of
+	// each range, by index, whichever arrives first, until the other one
+	// arrives to be checked against it
+	overlaps := make(map[int]CodedSymbol[T])
+	check := func(idx int, c CodedSymbol[T]) bool {
+		if o, ok := overlaps[idx]; ok {
+			delete(overlaps, idx)
+			return o.Hash == c.Hash && o.Count == c.Count
+		}
+		overlaps[idx] = c
+		return true
+	}
+	fail := func(e error) {
+		if err == nil && !done {
+			err = e
+		}
+		cancel()
+	}
+
+	var wg sync.WaitGroup
+	for _, src := range sources {
+		wg.Add(1)
+		go func(src RangeSource[T]) {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				if done || err != nil {
+					mu.Unlock()
+					return
+				}
+				from := next
+				count := min(maxSymbolBatch, max(minSymbolBatch, next/len(sources)))
+				next += count
+				mu.Unlock()
+
+				// fetch one more coded symbol before the range, except for
+				// the first range
+				start := max(from-1, 0)
+				cs, e := src.CodedSymbols(ctx, start, from+count-start)
+				mu.Lock()
+				if e == nil && len(cs) != from+count-start {
+					e = ErrMalformed
+				}
+				if e != nil {
+					fail(e)
+					mu.Unlock()
+					return
+				}
+				if !done {
+					if from != 0 {
+						if !check(from-1, cs[0]) {
+							fail(ErrInconsistentSources)
+							mu.Unlock()
+							return
+						}
+						cs = cs[1:]
+					}
+					if !check(from+count-1, cs[len(cs)-1]) {
+						fail(ErrInconsistentSources)
+						mu.Unlock()
+						return
+					}
+					if _, done = dec.AddCodedSymbolsAt(from, cs); done {
+						cancel()
+					}
+				}
+				mu.Unlock()
+			}
+		}(src)
+	}
+	wg.Wait()
+	return err
+}
@@ -0,0 +1,84 @@
+package riblt
+
+import (
+	"context"
+	"encoding/binary"
+	"net/http/httptest"
+	"testing"
+)
+
+// newReplicas starts n Handlers, each serving a SketchIndex of source symbols
+// [0, size) except for the first skip ones of the first replica. Replicas
+// insert source symbols in different orders.
+func newReplicas(t *testing.T, n, size, skip int) []RangeSource[testSymbol] {
+	// size must be coprime to the primes, so that each replica takes a
+	// permutation of [0, size)
+	primes := []int{7919, 7927, 7933}
+	var sources []RangeSource[testSymbol]
+	for r := 0; r < n; r++ {
+		x := NewSketchIndex[testSymbol](0, nil)
+		for i := 0; i < size; i++ {
+			j := (i*primes[r%len(primes)] + r) % size
+			if r == 0 && j < skip {
+				continue
+			}
+			x.AddSymbol(newTestSymbol(uint64(j)))
+		}
+		srv := httptest.NewServer(NewHandler(x))
+		t.Cleanup(srv.Close)
+		sources = append(sources, &Client[testSymbol]{URL: srv.URL})
+	}
+	return sources
+}
+
+func TestSyncMulti(t *testing.T) {
+	sources := newReplicas(t, 3, 5000, 0)
+	dec := &Decoder[testSymbol]{}
+	for i := 1000; i < 6000; i++ {
+		dec.AddSymbol(newTestSymbol(uint64(i)))
+	}
+	if err := SyncMulti(context.Background(), dec, sources...); err != nil {
+		t.Fatal(err)
+	}
+	if len(dec.Remote()) != 1000 || len(dec.Local()) != 1000 {
+		t.Fatalf("recovered %d remote and %d local symbols, expected 1000 and 1000", len(dec.Remote()), len(dec.Local()))
+	}
+	for _, s := range dec.Remote() {
+		if i := binary.LittleEndian.Uint64(s.Symbol[:]); i >= 1000 || s.Symbol != newTestSymbol(i) {
+			t.Fatalf("recovered corrupted source symbol")
+		}
+	}
+}
+
+func TestSyncMultiInconsistent(t *testing.T) {
+	sources := newReplicas(t, 3, 5000, 500)
+	dec := &Decoder[testSymbol]{}
+	for i := 1000; i < 6000; i++ {
+		dec.AddSymbol(newTestSymbol(uint64(i)))
+	}
+	if err := SyncMulti(context.Background(), dec, sources...); err != ErrInconsistentSources {
+		t.Fatalf("got error %v, expected ErrInconsistentSources", err)
+	}
+}
+
+func TestSyncMultiReuseClient(t *testing.T) {
+	x := NewSketchIndex[testSymbol](0, nil)
+	for i := 0; i < 1000; i++ {
+		x.AddSymbol(newTestSymbol(uint64(i)))
+	}
+	srv := httptest.NewServer(NewHandler(x))
+	defer srv.Close()
+	c := &Client[testSymbol]{URL: srv.URL}
+	for round := 0; round < 2; round++ {
+		// the set changes between sessions, which must not fail the
+		// second one
+		x.AddSymbol(newTestSymbol(uint64(1000 + round)))
+		dec := &Decoder[testSymbol]{}
+		if err := SyncMulti(context.Background(), dec, c, c); err != nil {
+			t.Fatalf("round %d: %v", round, err)
+		}
+		if len(dec.Remote()) != 1001+round {
+			t.Fatalf("round %d: recovered %d remote symbols, expected %d", round, len(dec.Remote()), 1001+round)
+		}
+	}
+}
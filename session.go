@@ -0,0 +1,246 @@
+package riblt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var (
+	// ErrPayloadMismatch is returned when a payload received from the peer
+	// does not match the requested digest.
+	ErrPayloadMismatch = errors.New("riblt: payload does not match digest")
+	// ErrTooManySymbols is returned when a session exceeds the number of
+	// coded symbols it may exchange without decoding the difference.
+	ErrTooManySymbols = errors.New("riblt: difference not decoded within the coded symbol limit")
+)
+
+// Messages of a session between ServeDigests and SyncDigests. Each message is
+// a frame, made of the message type, the uvarint length of the body, and the
+// body.
+const (
+	// client requests coded symbols, body is the uvarint number of coded
+	// symbols; server replies with a msgSymbols frame of the next coded
+	// symbols
+	msgSymbols byte = iota + 1
+	// client requests payloads, body is the uvarint number of digests
+	// followed by the digests; server replies with one msgPayload frame for
+	// each digest, in the same order
+	msgFetch
+	msgPayload
+	// client ends the session, body is empty
+	msgDone
+	// server failed to serve a request, body is the error message
+	msgError
+)
+
+const (
+	// maxFrameSize is the largest frame accepted, which limits the size of
+	// payloads and of batches of coded symbols
+	maxFrameSize = 1 << 26
+	// number of coded symbols requested in the first batch; each following
+	// batch doubles in size up to maxSymbolBatch
+	minSymbolBatch = 16
+	maxSymbolBatch = 1 << 16
+	// number of payloads requested at a time
+	maxFetchBatch = 256
+	// number of coded symbols exchanged in a session before giving up,
+	// enough for differences of about 3 million digests
+	maxSessionSymbols = 1 << 22
+)
+
+// conn reads and writes frames.
+type conn struct {
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func newConn(rw io.ReadWriter) *conn {
+	return &conn{bufio.NewReader(rw), bufio.NewWriter(rw)}
+}
+
+func (c *conn) writeFrame(typ byte, body []byte) error {
+	c.w.WriteByte(typ)
+	c.w.Write(binary.AppendUvarint(nil, uint64(len(body))))
+	_, err := c.w.Write(body)
+	return err
+}
+
+func (c *conn) readFrame() (byte, []byte, error) {
+	typ, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, err := binary.ReadUvarint(c.r)
+	if err != nil {
+		return 0, nil, noEOF(err)
+	}
+	if n > maxFrameSize {
+		return 0, nil, ErrMalformed
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, noEOF(err)
+	}
+	return typ, body, nil
+}
+
+// expectFrame reads a frame of type typ, and turns a msgError frame into an
+// error.
+func (c *conn) expectFrame(typ byte) ([]byte, error) {
+	t, body, err := c.readFrame()
+	switch {
+	case err != nil:
+		return nil, err
+	case t == msgError:
+		return nil, errors.New("riblt: peer: " + string(body))
+	case t != typ:
+		return nil, ErrMalformed
+	}
+	return body, nil
+}
+
+// noEOF turns io.EOF in the middle of a frame into io.ErrUnexpectedEOF.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// ServeDigests serves a session started by SyncDigests over rw. It sends the
+// coded symbols produced by src, which must not have produced any coded
+// symbol, and the payloads in store requested by the peer, until the peer
+// ends the session. src is typically an Encoder, or the Source of a
+// SketchIndex, holding the digests of the payloads in store. It returns
+// ErrTooManySymbols if the peer requests more coded symbols than a session
+// may exchange, see SyncDigests.
+func ServeDigests(rw io.ReadWriter, src CodedSymbolSource[Digest], store Store) error {
+	c := newConn(rw)
+	sent := uint64(0)
+	for {
+		typ, body, err := c.readFrame()
+		if err != nil {
+			return err
+		}
+		r := &reader{b: body}
+		switch typ {
+		case msgSymbols:
+			n := r.uvarint()
+			if r.err != nil || n > maxSymbolBatch {
+				return ErrMalformed
+			}
+			if sent += n; sent > maxSessionSymbols {
+				c.writeFrame(msgError, []byte(ErrTooManySymbols.Error()))
+				c.w.Flush()
+				return ErrTooManySymbols
+			}
+			var b []byte
+			for i := uint64(0); i < n; i++ {
+				if b, err = appendCodedSymbol(b, src.ProduceNextCodedSymbol()); err != nil {
+					return err
+				}
+			}
+			c.writeFrame(msgSymbols, b)
+		case msgFetch:
+			n := r.length()
+			ds := make([]Digest, 0, n)
+			for i := 0; i < n && r.err == nil; i++ {
+				if d := r.bytes(len(Digest{})); r.err == nil {
+					ds = append(ds, Digest(d))
+				}
+			}
+			if r.err != nil || len(r.b) != 0 {
+				return ErrMalformed
+			}
+			for _, d := range ds {
+				data, err := store.Get(d)
+				if err != nil {
+					c.writeFrame(msgError, []byte(err.Error()))
+					c.w.Flush()
+					return err
+				}
+				c.writeFrame(msgPayload, data)
+			}
+		case msgDone:
+			return nil
+		default:
+			return ErrMalformed
+		}
+		if err := c.w.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// SyncDigests runs a session with a peer calling ServeDigests over rw, in two
+// phases. First, it passes the coded symbols of the peer's digests to dec, in
+// batches of growing size, until dec has decoded the symmetric difference.
+// dec must hold the digests of the payloads in store, and must not have
+// received any coded symbol. Then, it fetches the payloads of the digests
+// exclusive to the peer, i.e., dec.Remote(), verifies them against their
+// digests, and puts them into store. Digests exclusive to the local set,
+// i.e., dec.Local(), are left to the caller. It gives up and returns
+// ErrTooManySymbols if dec has not decoded the difference after receiving
+// 2^22 coded symbols, enough for differences of about 3 million digests, so
+// that a peer sending inconsistent coded symbols cannot keep it going
+// forever.
+func SyncDigests(rw io.ReadWriter, dec *Decoder[Digest], store Store) error {
+	c := newConn(rw)
+	received := 0
+	for batch, done := minSymbolBatch, false; !done; batch = min(batch*2, maxSymbolBatch) {
+		if received >= maxSessionSymbols {
+			c.writeFrame(msgDone, nil)
+			c.w.Flush()
+			return ErrTooManySymbols
+		}
+		batch = min(batch, maxSessionSymbols-received)
+		received += batch
+		c.writeFrame(msgSymbols, binary.AppendUvarint(nil, uint64(batch)))
+		if err := c.w.Flush(); err != nil {
+			return err
+		}
+		body, err := c.expectFrame(msgSymbols)
+		if err != nil {
+			return err
+		}
+		r := &reader{b: body}
+		cs := make([]CodedSymbol[Digest], 0, batch)
+		for i := 0; i < batch && r.err == nil; i++ {
+			cs = append(cs, readCodedSymbol[Digest](r))
+		}
+		if r.err != nil || len(r.b) != 0 {
+			return ErrMalformed
+		}
+		_, done = dec.AddCodedSymbols(cs)
+	}
+
+	remote := dec.Remote()
+	for len(remote) != 0 {
+		batch := remote[:min(len(remote), maxFetchBatch)]
+		remote = remote[len(batch):]
+		b := binary.AppendUvarint(nil, uint64(len(batch)))
+		for _, s := range batch {
+			b = append(b, s.Symbol[:]...)
+		}
+		c.writeFrame(msgFetch, b)
+		if err := c.w.Flush(); err != nil {
+			return err
+		}
+		for _, s := range batch {
+			data, err := c.expectFrame(msgPayload)
+			if err != nil {
+				return err
+			}
+			if DigestOf(data) != s.Symbol {
+				return ErrPayloadMismatch
+			}
+			if err := store.Put(s.Symbol, data); err != nil {
+				return err
+			}
+		}
+	}
+	c.writeFrame(msgDone, nil)
+	return c.w.Flush()
+}
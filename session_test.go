@@ -0,0 +1,104 @@
+package riblt
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// newTestPayload returns a payload of the given size that is unique to i.
+func newTestPayload(i uint64, size int) []byte {
+	data := make([]byte, size)
+	binary.LittleEndian.PutUint64(data, i)
+	return data
+}
+
+// runDigestSession runs a session between a server holding payloads
+// [0, nserver) and a client holding payloads [offset, offset+nclient), and
+// returns the client's Decoder and Store.
+func runDigestSession(t *testing.T, nserver, nclient, offset int) (*Decoder[Digest], *MapStore) {
+	server := &MapStore{}
+	enc := &Encoder[Digest]{}
+	for i := 0; i < nserver; i++ {
+		enc.AddSymbol(server.Add(newTestPayload(uint64(i), 10240)))
+	}
+	client := &MapStore{}
+	dec := &Decoder[Digest]{}
+	for i := offset; i < offset+nclient; i++ {
+		dec.AddSymbol(client.Add(newTestPayload(uint64(i), 10240)))
+	}
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	errc := make(chan error)
+	go func() {
+		errc <- ServeDigests(c1, enc, server)
+	}()
+	if err := SyncDigests(c2, dec, client); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	return dec, client
+}
+
+func TestDigestSession(t *testing.T) {
+	dec, client := runDigestSession(t, 1000, 1000, 300)
+	if len(dec.Remote()) != 300 || len(dec.Local()) != 300 {
+		t.Fatalf("recovered %d remote and %d local digests, expected 300 and 300", len(dec.Remote()), len(dec.Local()))
+	}
+	if client.Len() != 1300 {
+		t.Fatalf("client has %d payloads, expected 1300", client.Len())
+	}
+	for i := 0; i < 300; i++ {
+		if _, err := client.Get(DigestOf(newTestPayload(uint64(i), 10240))); err != nil {
+			t.Errorf("payload %d not fetched: %v", i, err)
+		}
+	}
+}
+
+func TestDigestSessionEqualSets(t *testing.T) {
+	dec, _ := runDigestSession(t, 100, 100, 0)
+	if len(dec.Remote()) != 0 || len(dec.Local()) != 0 {
+		t.Fatalf("recovered %d remote and %d local digests, expected none", len(dec.Remote()), len(dec.Local()))
+	}
+}
+
+func TestDigestSessionMissingPayload(t *testing.T) {
+	enc := &Encoder[Digest]{}
+	enc.AddSymbol(DigestOf([]byte("missing")))
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	errc := make(chan error)
+	go func() {
+		errc <- ServeDigests(c1, enc, &MapStore{})
+	}()
+	if err := SyncDigests(c2, &Decoder[Digest]{}, &MapStore{}); err == nil {
+		t.Errorf("client succeeded fetching a missing payload")
+	}
+	if err := <-errc; err != ErrNotFound {
+		t.Errorf("server returned %v, expected ErrNotFound", err)
+	}
+}
+
+func TestServeDigestsMalformedFetch(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	errc := make(chan error)
+	go func() {
+		errc <- ServeDigests(c1, &Encoder[Digest]{}, &MapStore{})
+	}()
+	// one digest is announced, but only 5 bytes follow
+	c := newConn(c2)
+	c.writeFrame(msgFetch, []byte{1, 1, 2, 3, 4, 5})
+	if err := c.w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != ErrMalformed {
+		t.Errorf("server returned %v, expected ErrMalformed", err)
+	}
+}
@@ -1,34 +1,75 @@
 package riblt
 
+import (
+	"errors"
+)
+
 // Sketch is a prefix of the coded symbol sequence for a set of source symbols.
 // When generating a prefix of predetermined length, compared to generating the
 // prefix incrementally using an Encoder, it is more efficient to use Sketch.
 // Sketch also allows inserting or deleting source symbols from the set after
-// it has been created.
+// it has been created. A Sketch of length n may be created using make, unless
+// T implements Zeroer, in which case it must be created using NewSketch.
 type Sketch[T Symbol[T]] []CodedSymbol[T]
 
+// NewSketch returns a Sketch of length n of the empty set.
+func NewSketch[T Symbol[T]](n int) Sketch[T] {
+	s := make(Sketch[T], n)
+	if isZeroer[T]() {
+		for i := range s {
+			s[i] = emptyCodedSymbol[T]()
+		}
+	}
+	return s
+}
+
 // AddHashedSymbol inserts source symbol t to the set of which s is a sketch.
 func (s Sketch[T]) AddHashedSymbol(t HashedSymbol[T]) {
-	m := randomMapping{t.Hash, 0}
+	s.AddHashedSymbolWith(t, nil)
+}
+
+// RemoveHashedSymbol deletes source symbol t from the set of which s is a
+// sketch.
+func (s Sketch[T]) RemoveHashedSymbol(t HashedSymbol[T]) {
+	s.RemoveHashedSymbolWith(t, nil)
+}
+
+// AddHashedSymbolWith inserts source symbol t to the set of which s is a
+// sketch, where source symbols are mapped to coded symbols using Mapping g. A
+// nil g stands for RandomMapping. A sketch must be built and decoded using
+// the same Mapping.
+func (s Sketch[T]) AddHashedSymbolWith(t HashedSymbol[T], g Mapping) {
+	m := newMapping(g, t.Hash)
 	for int(m.lastIdx) < len(s) {
 		idx := m.lastIdx
 		s[idx].Symbol = s[idx].Symbol.XOR(t.Symbol)
 		s[idx].Count += 1
 		s[idx].Hash ^= t.Hash
-		m.nextIndex()
+		m.next(g)
 	}
 }
 
-// RemoveHashedSymbol deletes source symbol t from the set of which s is a
-// sketch.
-func (s Sketch[T]) RemoveHashedSymbol(t HashedSymbol[T]) {
-	m := randomMapping{t.Hash, 0}
+// AddHashedSymbolChecked inserts source symbol t to the set of which s is a
+// sketch like AddHashedSymbolWith, after recording t in c. It returns false if
+// t collides with a source symbol recorded in c before, see
+// CollisionDetector.Add, in which case t is still inserted.
+func (s Sketch[T]) AddHashedSymbolChecked(t HashedSymbol[T], g Mapping, c *CollisionDetector[T]) bool {
+	ok := c.Add(t)
+	s.AddHashedSymbolWith(t, g)
+	return ok
+}
+
+// RemoveHashedSymbolWith deletes source symbol t from the set of which s is a
+// sketch, where source symbols are mapped to coded symbols using Mapping g. A
+// nil g stands for RandomMapping.
+func (s Sketch[T]) RemoveHashedSymbolWith(t HashedSymbol[T], g Mapping) {
+	m := newMapping(g, t.Hash)
 	for int(m.lastIdx) < len(s) {
 		idx := m.lastIdx
 		s[idx].Symbol = s[idx].Symbol.XOR(t.Symbol)
 		s[idx].Count -= 1
 		s[idx].Hash ^= t.Hash
-		m.nextIndex()
+		m.next(g)
 	}
 }
 
@@ -69,10 +110,59 @@ func (s Sketch[T]) Subtract(s2 Sketch[T]) {
 // symbols in S in case 1, or S \ S2 in case 2 (\ is the set subtraction
 // operation). rev is empty in case 1, or S2 \ S in case 2.
 func (s Sketch[T]) Decode() (fwd []HashedSymbol[T], rev []HashedSymbol[T], succ bool) {
+	return s.DecodeWith(nil)
+}
+
+// DecodeWith is the same as Decode, except that source symbols are mapped to
+// coded symbols using Mapping g. A nil g stands for RandomMapping.
+func (s Sketch[T]) DecodeWith(g Mapping) (fwd []HashedSymbol[T], rev []HashedSymbol[T], succ bool) {
 	dec := Decoder[T]{}
+	dec.SetMapping(g)
 	for _, c := range s {
 		dec.AddCodedSymbol(c)
 	}
 	dec.TryDecode()
 	return dec.Remote(), dec.Local(), dec.Decoded()
 }
+
+// Source returns a CodedSymbolSource that produces the coded symbols in s, in
+// order. It allows a Decoder to take the coded symbols of its local set from
+// a precomputed Sketch, so that decoding takes time independent of the size
+// of the local set. See Decoder.SetLocalSource. Since s is only a prefix of
+// the coded symbol sequence, the Decoder must finish decoding within len(s)
+// coded symbols. If it needs more, the CodedSymbolSource produces empty coded
+// symbols, which make decoding results invalid, and its Err method returns
+// ErrSketchTooShort. Choose the length of s according to the differences
+// expected, e.g., using SketchLength, or use a SketchIndex, which
+// grows as needed.
+func (s Sketch[T]) Source() *SketchSource[T] {
+	return &SketchSource[T]{sketch: s}
+}
+
+// ErrSketchTooShort is returned when more coded symbols are taken from a
+// Sketch than its length.
+var ErrSketchTooShort = errors.New("riblt: sketch too short for the difference")
+
+// SketchSource is a CodedSymbolSource that takes coded symbols from a Sketch.
+// See Sketch.Source.
+type SketchSource[T Symbol[T]] struct {
+	sketch Sketch[T]
+	next   int
+	err    error
+}
+
+// ProduceNextCodedSymbol implements CodedSymbolSource.
+func (s *SketchSource[T]) ProduceNextCodedSymbol() CodedSymbol[T] {
+	if s.next >= len(s.sketch) {
+		s.err = ErrSketchTooShort
+		return emptyCodedSymbol[T]()
+	}
+	s.next += 1
+	return s.sketch[s.next-1]
+}
+
+// Err returns ErrSketchTooShort if s has been asked for more coded symbols
+// than the length of the Sketch, and nil otherwise.
+func (s *SketchSource[T]) Err() error {
+	return s.err
+}
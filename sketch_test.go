@@ -26,3 +26,69 @@ func BenchmarkSketchAddSymbol(b *testing.B) {
 	}
 }
 
+
+func TestDecodeWithLocalSketch(t *testing.T) {
+	enc := Encoder[testSymbol]{}
+	local := NewSketchIndex[testSymbol](16, nil)
+	var nextId uint64
+	for i := 0; i < 50; i++ {
+		local.AddSymbol(newTestSymbol(nextId))
+		nextId += 1
+		enc.AddSymbol(newTestSymbol(nextId))
+		nextId += 1
+	}
+	for i := 0; i < 2000; i++ {
+		local.AddSymbol(newTestSymbol(nextId))
+		enc.AddSymbol(newTestSymbol(nextId))
+		nextId += 1
+	}
+	precomputed, _ := local.Snapshot(1000)
+
+	// decode using a fixed Sketch and a growing SketchIndex
+	dec1 := Decoder[testSymbol]{}
+	dec1.SetLocalSource(precomputed.Source())
+	dec2 := Decoder[testSymbol]{}
+	src := local.Source()
+	dec2.SetLocalSource(src)
+	for {
+		c := enc.ProduceNextCodedSymbol()
+		dec1.AddCodedSymbol(c)
+		dec2.AddCodedSymbol(c)
+		dec1.TryDecode()
+		dec2.TryDecode()
+		if dec1.Decoded() && dec2.Decoded() {
+			break
+		}
+	}
+	for _, dec := range []*Decoder[testSymbol]{&dec1, &dec2} {
+		if len(dec.Remote()) != 50 || len(dec.Local()) != 50 {
+			t.Errorf("recovered %d remote and %d local symbols, expected 50 and 50", len(dec.Remote()), len(dec.Local()))
+		}
+	}
+	if src.Err() != nil {
+		t.Error(src.Err())
+	}
+
+	// changing the set invalidates the source once it needs more coded
+	// symbols
+	local.AddSymbol(newTestSymbol(nextId))
+	for i := 0; i < 1000; i++ {
+		src.ProduceNextCodedSymbol()
+	}
+	if src.Err() != ErrSetChanged {
+		t.Errorf("expected ErrSetChanged, got %v", src.Err())
+	}
+	// a Sketch too short for the session is reported instead of panicking
+	short := precomputed[:10].Source()
+	dec := Decoder[testSymbol]{}
+	dec.SetLocalSource(short)
+	for i := 0; i < 20; i++ {
+		dec.AddCodedSymbol(precomputed[i])
+		if i < 10 && short.Err() != nil {
+			t.Fatalf("got %v after %d coded symbols", short.Err(), i+1)
+		}
+	}
+	if short.Err() != ErrSketchTooShort {
+		t.Errorf("expected ErrSketchTooShort, got %v", short.Err())
+	}
+}
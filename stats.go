@@ -0,0 +1,112 @@
+package riblt
+
+import (
+	"sort"
+)
+
+// DecoderStats summarizes the work done by a Decoder.
+type DecoderStats struct {
+	// CodedSymbols is the number of coded symbols received.
+	CodedSymbols int
+	// Missing is the number of coded symbols skipped by AddCodedSymbolAt
+	// and not received since.
+	Missing int
+	// DecodedSymbols is the number of coded symbols that are decoded.
+	DecodedSymbols int
+	// Peels is the number of times a recovered source symbol was peeled off
+	// a coded symbol.
+	Peels int
+	// Remote is the number of recovered source symbols exclusive to A.
+	Remote int
+	// Local is the number of recovered source symbols exclusive to B.
+	Local int
+	// MinPrefix is the smallest number of coded symbols that would have been
+	// sufficient to decode the symmetric difference, regardless of how many
+	// coded symbols have been received and how often TryDecode was called,
+	// had none of them been missing. It is 0 if the Decoder is not decoded or
+	// has not received any coded symbol.
+	MinPrefix int
+}
+
+// Stats returns statistics about d. Computing MinPrefix takes time linear to
+// the size of the symmetric difference times the logarithm of the number of
+// coded symbols received.
+func (d *Decoder[T]) Stats() DecoderStats {
+	st := DecoderStats{
+		CodedSymbols:   len(d.cs) - d.nmissing,
+		Missing:        d.nmissing,
+		DecodedSymbols: d.decoded,
+		Peels:          d.peels,
+		Remote:         len(d.remote.symbols),
+		Local:          len(d.local.symbols),
+	}
+	if len(d.cs) != 0 && d.Decoded() {
+		st.MinPrefix = d.minPrefix()
+	}
+	return st
+}
+
+// minPrefix returns the smallest n such that the first n coded symbols alone
+// are sufficient to recover the symmetric difference, which must have been
+// fully recovered. Whether peeling succeeds depends only on which coded
+// symbols each source symbol in the difference is mapped to, so we can replay
+// peeling on the mappings alone. Success is monotonic in n, because every
+// coded symbol in a shorter prefix is also in a longer one.
+func (d *Decoder[T]) minPrefix() int {
+	hashes := make([]uint64, 0, len(d.remote.symbols)+len(d.local.symbols))
+	for _, s := range d.remote.symbols {
+		hashes = append(hashes, s.Hash)
+	}
+	for _, s := range d.local.symbols {
+		hashes = append(hashes, s.Hash)
+	}
+	return 1 + sort.Search(len(d.cs)-1, func(i int) bool {
+		return peelable(d.mapping, hashes, i+1)
+	})
+}
+
+// peelable returns whether peeling recovers every source symbol, identified by
+// its hash, from the first n coded symbols of the sequence defined for them
+// under Mapping g.
+func peelable(g Mapping, hashes []uint64, n int) bool {
+	// For each coded symbol, we track the number of source symbols mapped to
+	// it and the XOR of their positions in hashes, so that the position of
+	// the only remaining source symbol is known when the count drops to 1.
+	count := make([]int, n)
+	sum := make([]int, n)
+	edges := make([][]int, len(hashes))
+	for i, h := range hashes {
+		m := newMapping(g, h)
+		for int(m.lastIdx) < n {
+			cidx := int(m.lastIdx)
+			edges[i] = append(edges[i], cidx)
+			count[cidx] += 1
+			sum[cidx] ^= i
+			m.next(g)
+		}
+	}
+	var pure []int
+	for cidx := range count {
+		if count[cidx] == 1 {
+			pure = append(pure, cidx)
+		}
+	}
+	recovered := 0
+	for len(pure) != 0 {
+		cidx := pure[len(pure)-1]
+		pure = pure[:len(pure)-1]
+		if count[cidx] != 1 {
+			continue
+		}
+		i := sum[cidx]
+		recovered += 1
+		for _, e := range edges[i] {
+			count[e] -= 1
+			sum[e] ^= i
+			if count[e] == 1 {
+				pure = append(pure, e)
+			}
+		}
+	}
+	return recovered == len(hashes)
+}
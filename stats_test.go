@@ -0,0 +1,71 @@
+package riblt
+
+import (
+	"testing"
+)
+
+func TestStatsMinPrefix(t *testing.T) {
+	enc := Encoder[testSymbol]{}
+	ref := Decoder[testSymbol]{}
+	dec := Decoder[testSymbol]{}
+
+	var nextId uint64
+	for i := 0; i < 300; i++ {
+		s := newTestSymbol(nextId)
+		nextId += 1
+		ref.AddSymbol(s)
+		dec.AddSymbol(s)
+	}
+	for i := 0; i < 200; i++ {
+		s := newTestSymbol(nextId)
+		nextId += 1
+		enc.AddSymbol(s)
+	}
+	for i := 0; i < 1000; i++ {
+		s := newTestSymbol(nextId)
+		nextId += 1
+		enc.AddSymbol(s)
+		ref.AddSymbol(s)
+		dec.AddSymbol(s)
+	}
+
+	// ref decodes after every coded symbol, so the number of coded symbols it
+	// received is the minimum prefix length
+	var cs []CodedSymbol[testSymbol]
+	for !ref.Decoded() || len(cs) == 0 {
+		c := enc.ProduceNextCodedSymbol()
+		cs = append(cs, c)
+		ref.AddCodedSymbol(c)
+		ref.TryDecode()
+	}
+	if st := ref.Stats(); st.MinPrefix != len(cs) {
+		t.Errorf("MinPrefix is %d, expected %d", st.MinPrefix, len(cs))
+	}
+
+	// dec receives many more coded symbols than necessary before decoding
+	for i := 0; i < 500; i++ {
+		cs = append(cs, enc.ProduceNextCodedSymbol())
+	}
+	for _, c := range cs {
+		dec.AddCodedSymbol(c)
+	}
+	dec.TryDecode()
+	st := dec.Stats()
+	if st.MinPrefix != len(cs)-500 {
+		t.Errorf("MinPrefix is %d, expected %d", st.MinPrefix, len(cs)-500)
+	}
+	if st.CodedSymbols != len(cs) || st.DecodedSymbols != len(cs) {
+		t.Errorf("decoded %d out of %d coded symbols, expected %d", st.DecodedSymbols, st.CodedSymbols, len(cs))
+	}
+	if st.Remote != 200 || st.Local != 300 {
+		t.Errorf("recovered %d remote and %d local symbols, expected 200 and 300", st.Remote, st.Local)
+	}
+	if st.Peels == 0 {
+		t.Errorf("no peel operation recorded")
+	}
+
+	dec.Reset()
+	if st := dec.Stats(); st != (DecoderStats{}) {
+		t.Errorf("stats not cleared after Reset: %+v", st)
+	}
+}
@@ -26,7 +26,9 @@
 // the Encoder and the Decoder, respectively. The user should program Alice to
 // stream coded symbols over a reliable transport to Bob, and program Bob to
 // decode the symbols and signal Alice to stop when successful. See the
-// example.
+// example. Over an unreliable transport, Alice should tag each coded symbol
+// with its index, so that Bob can tolerate losses and reordering. See
+// Decoder.AddCodedSymbolAt.
 package riblt
 
 // Symbol is the interface that source symbols (set elements being reconciled)
@@ -39,24 +41,87 @@ package riblt
 //  3. For every a in the group, a $ a = e.
 // As an example, when source symbols are plain byte strings of length 32, T is
 // [32]byte. $ can be the bitwise exclusive-or (XOR) operation. e is the byte
-// string where every byte is zero.
+// string where every byte is zero. For long byte strings, XOR should process
+// a machine word or more at a time, e.g., using crypto/subtle.XORBytes, as XOR
+// is called for every source symbol mapped to every coded symbol. Bytes
+// implements Symbol for byte strings of arbitrary length this way.
 type Symbol[T any] interface {
 	// XOR returns t $ t2, where t is the method receiver. XOR is allowed to
 	// modify the method receiver in-place (when T is a pointer) and return the
-	// modified t. Although the method is called XOR (because the bitwise
-	// exclusive-or operation is a valid group operation for groups of
-	// fixed-length byte strings), it can implement any operation that satisfy
-	// the aforementioned properties.
+	// modified t, in which case T should implement Zeroer and Cloner.
+	// Although the method is called XOR (because the bitwise exclusive-or
+	// operation is a valid group operation for groups of fixed-length byte
+	// strings), it can implement any operation that satisfy the
+	// aforementioned properties.
 	XOR(t2 T) T
 	// Hash returns the hash of the method receiver. It must not modify the
 	// method receiver. It must not be homomorphic over the group operation.
 	// That is, the probability that
 	//   (a $ b).Hash() == a.Hash() ^ b.Hash()
 	// must be negligible. Here, ^ on the right-hand side is the bitwise
-	// exclusive-or operation.
+	// exclusive-or operation. Distinct source symbols in the two sets must
+	// have distinct hashes, which Encoder.DetectCollisions and
+	// Decoder.DetectCollisions check for. Hasher implements suitable hash
+	// functions for common types.
 	Hash() uint64
 }
 
+// Zeroer is an optional interface for source symbols, for which the default
+// value of T cannot serve as e, the identity element of the group. This is the
+// case for pointer types, whose default value is nil, if XOR does not accept
+// nil operands, or returns its argument unchanged when the receiver is nil,
+// so that later in-place XORs modify the argument.
+type Zeroer[T any] interface {
+	// Zero returns a newly allocated e. It is called on the default value
+	// of T, e.g., a nil pointer, so it must not access the method receiver.
+	Zero() T
+}
+
+// Cloner is an optional interface for source symbols whose values share
+// memory when copied, such as pointer and slice types. When T implements
+// Cloner, the package clones source symbols before modifying them in place
+// or handing them out, so that coded symbols passed to a Decoder, and source
+// symbols returned by the Decoder, never share memory with each other. T
+// should implement Zeroer as well.
+type Cloner[T any] interface {
+	// Clone returns a deep copy of the method receiver.
+	Clone() T
+}
+
+// zeroSymbol returns e, the identity element of the group of T.
+func zeroSymbol[T any]() T {
+	var t T
+	// converting the default value to an interface does not allocate
+	if z, ok := any(t).(Zeroer[T]); ok {
+		return z.Zero()
+	}
+	return t
+}
+
+// isZeroer returns whether T implements Zeroer.
+func isZeroer[T any]() bool {
+	var t T
+	_, ok := any(t).(Zeroer[T])
+	return ok
+}
+
+// isCloner returns whether T implements Cloner.
+func isCloner[T any]() bool {
+	var t T
+	_, ok := any(t).(Cloner[T])
+	return ok
+}
+
+// cloneSymbol returns a copy of t that does not share memory with t.
+func cloneSymbol[T Symbol[T]](t T) T {
+	if isCloner[T]() {
+		return any(t).(Cloner[T]).Clone()
+	}
+	// allocate a symbol and then XOR with t, so that we are guaranteed to
+	// copy t whether or not the symbol interface is implemented as a pointer
+	return zeroSymbol[T]().XOR(t)
+}
+
 // HashedSymbol is the bundle of a symbol and its hash computed using its Hash
 // method.
 type HashedSymbol[T Symbol[T]] struct {
@@ -70,6 +135,11 @@ type CodedSymbol[T Symbol[T]] struct {
 	Count int64
 }
 
+// emptyCodedSymbol returns a coded symbol that no source symbol is mapped to.
+func emptyCodedSymbol[T Symbol[T]]() CodedSymbol[T] {
+	return CodedSymbol[T]{HashedSymbol: HashedSymbol[T]{Symbol: zeroSymbol[T]()}}
+}
+
 const (
 	add    = 1
 	remove = -1
@@ -83,3 +153,21 @@ func (c CodedSymbol[T]) apply(s HashedSymbol[T], direction int64) CodedSymbol[T]
 	c.Count += direction
 	return c
 }
+
+// merge adds c2 to c, i.e., applies each source symbol mapped to c2 to c in
+// the same direction.
+func (c CodedSymbol[T]) merge(c2 CodedSymbol[T]) CodedSymbol[T] {
+	c.Symbol = c.Symbol.XOR(c2.Symbol)
+	c.Hash ^= c2.Hash
+	c.Count += c2.Count
+	return c
+}
+
+// subtract subtracts c2 from c, i.e., applies each source symbol mapped to c2
+// to c in the opposite direction.
+func (c CodedSymbol[T]) subtract(c2 CodedSymbol[T]) CodedSymbol[T] {
+	c.Symbol = c.Symbol.XOR(c2.Symbol)
+	c.Hash ^= c2.Hash
+	c.Count -= c2.Count
+	return c
+}
@@ -0,0 +1,167 @@
+package riblt
+
+import (
+	"encoding/binary"
+	"github.com/dchest/siphash"
+	"testing"
+)
+
+// ptrSymbol is a pointer-backed source symbol, whose XOR modifies the
+// receiver in place. XOR panics on a nil receiver, so the package must never
+// use the default value of ptrSymbol as the identity element.
+type ptrSymbol = *ptrBox
+
+type ptrBox [4]uint64
+
+func (p *ptrBox) XOR(p2 *ptrBox) *ptrBox {
+	for i := range p {
+		p[i] ^= p2[i]
+	}
+	return p
+}
+
+func (p *ptrBox) Hash() uint64 {
+	buf := [32]byte{}
+	for i := range p {
+		binary.LittleEndian.PutUint64(buf[i*8:], p[i])
+	}
+	return siphash.Hash(567, 890, buf[:])
+}
+
+func (p *ptrBox) Zero() *ptrBox {
+	return &ptrBox{}
+}
+
+func (p *ptrBox) Clone() *ptrBox {
+	c := *p
+	return &c
+}
+
+func (p *ptrBox) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 32)
+	for i := range p {
+		binary.LittleEndian.PutUint64(buf[i*8:], p[i])
+	}
+	return buf, nil
+}
+
+func (p *ptrBox) UnmarshalBinary(data []byte) error {
+	if len(data) != 32 {
+		return ErrMalformed
+	}
+	for i := range p {
+		p[i] = binary.LittleEndian.Uint64(data[i*8:])
+	}
+	return nil
+}
+
+func newPtrSymbol(i uint64) ptrSymbol {
+	return &ptrBox{i, i * 3, i * 5, i * 7}
+}
+
+func TestPointerSymbol(t *testing.T) {
+	enc := Encoder[ptrSymbol]{}
+	dec1 := Decoder[ptrSymbol]{}
+	dec2 := Decoder[ptrSymbol]{}
+	var remote []ptrSymbol
+	var nextId uint64
+	for i := 0; i < 100; i++ {
+		s := newPtrSymbol(nextId)
+		nextId += 1
+		remote = append(remote, s)
+		enc.AddSymbol(s)
+		s = newPtrSymbol(nextId)
+		nextId += 1
+		dec1.AddSymbol(s)
+		dec2.AddSymbol(s)
+	}
+	for i := 0; i < 1000; i++ {
+		s := newPtrSymbol(nextId)
+		nextId += 1
+		enc.AddSymbol(s)
+		dec1.AddSymbol(s)
+		dec2.AddSymbol(s)
+	}
+
+	// both decoders receive the same coded symbols, which would corrupt one
+	// another if the decoders modified them in place
+	var cs []CodedSymbol[ptrSymbol]
+	for !dec1.Decoded() || !dec2.Decoded() || len(cs) == 0 {
+		c := enc.ProduceNextCodedSymbol()
+		cs = append(cs, c)
+		dec1.AddCodedSymbol(c)
+		dec2.AddCodedSymbol(c)
+		dec1.TryDecode()
+		dec2.TryDecode()
+	}
+	for i, s := range remote {
+		if *s != *newPtrSymbol(uint64(2 * i)) {
+			t.Fatalf("source symbol %d of the encoder is modified", i)
+		}
+	}
+	for _, dec := range []*Decoder[ptrSymbol]{&dec1, &dec2} {
+		if len(dec.Remote()) != 100 || len(dec.Local()) != 100 {
+			t.Fatalf("recovered %d remote and %d local symbols, expected 100 and 100", len(dec.Remote()), len(dec.Local()))
+		}
+		for _, s := range dec.Remote() {
+			if s.Symbol[0]%2 != 0 || *s.Symbol != *newPtrSymbol(s.Symbol[0]) {
+				t.Fatalf("recovered corrupted remote symbol %v", *s.Symbol)
+			}
+		}
+	}
+
+	// no two symbols held by the decoder or the caller share memory
+	seen := make(map[ptrSymbol]bool)
+	check := func(s ptrSymbol) {
+		if seen[s] {
+			t.Fatalf("symbol %v is shared", *s)
+		}
+		seen[s] = true
+	}
+	for _, c := range cs {
+		check(c.Symbol)
+	}
+	for _, dec := range []*Decoder[ptrSymbol]{&dec1, &dec2} {
+		for _, c := range dec.cs {
+			check(c.Symbol)
+		}
+		for _, s := range append(dec.Remote(), dec.Local()...) {
+			check(s.Symbol)
+		}
+	}
+
+	// the decoder can be serialized
+	data, err := dec2.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := Decoder[ptrSymbol]{}
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if *restored.Remote()[0].Symbol != *dec2.Remote()[0].Symbol {
+		t.Errorf("restored decoder differs")
+	}
+}
+
+func TestPointerSymbolSketch(t *testing.T) {
+	x := NewSketchIndex[ptrSymbol](50, nil)
+	s2 := NewSketch[ptrSymbol](50)
+	for i := uint64(0); i < 200; i++ {
+		x.AddSymbol(newPtrSymbol(i))
+		if i >= 10 {
+			s2.AddSymbol(newPtrSymbol(i))
+		}
+	}
+	s1, _ := x.Snapshot(50)
+	s1.Subtract(s2)
+	fwd, rev, succ := s1.Decode()
+	if !succ || len(fwd) != 10 || len(rev) != 0 {
+		t.Fatalf("failed to decode: %d forward and %d reverse symbols", len(fwd), len(rev))
+	}
+	// subtracting from the snapshot does not modify the index
+	s3, _ := x.Snapshot(50)
+	if s3[0].Count != 200 || s3[0].Hash == s1[0].Hash {
+		t.Errorf("snapshot shares memory with the index")
+	}
+}
@@ -0,0 +1,94 @@
+package riblt
+
+import (
+	"encoding"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// TestVector pins down the coded symbol sequence that RandomMapping and the
+// Encoder define for a set of source symbols, so that implementations in
+// other languages can verify that they are compatible with this package. It
+// is designed to be serialized as JSON. Source symbols are given as the hex
+// encoding of their MarshalBinary output, and XOR is the bitwise
+// exclusive-or of such byte strings. Hashes are given as 16-digit hex strings,
+// so that they survive JSON parsers that store numbers as floating points.
+// Hashes are part of the vector, so other implementations do not need to
+// reproduce the hash function.
+type TestVector struct {
+	Name         string                  `json:"name"`
+	Symbols      []TestVectorSymbol      `json:"symbols"`
+	CodedSymbols []TestVectorCodedSymbol `json:"coded_symbols"`
+}
+
+// TestVectorSymbol is a source symbol in a TestVector, along with the first
+// indices of the coded symbols it is mapped to. Indices has fewer elements
+// than requested if the sequence ends, i.e., the next index would exceed
+// math.MaxInt64.
+type TestVectorSymbol struct {
+	Symbol  string   `json:"symbol"`
+	Hash    string   `json:"hash"`
+	Indices []uint64 `json:"indices"`
+}
+
+// TestVectorCodedSymbol is a coded symbol in a TestVector.
+type TestVectorCodedSymbol struct {
+	Symbol string `json:"symbol"`
+	Hash   string `json:"hash"`
+	Count  int64  `json:"count"`
+}
+
+// GenerateTestVector returns the TestVector named name for the given set of
+// source symbols, listing the first nindices indices each source symbol is
+// mapped to, and the first ncoded coded symbols. It requires T to implement
+// encoding.BinaryMarshaler, and the source symbols to be of the same length
+// when serialized.
+func GenerateTestVector[T Symbol[T]](name string, symbols []HashedSymbol[T], nindices, ncoded int) (TestVector, error) {
+	v := TestVector{Name: name}
+	enc := Encoder[T]{}
+	for _, s := range symbols {
+		str, err := symbolHex(s.Symbol)
+		if err != nil {
+			return v, err
+		}
+		vs := TestVectorSymbol{Symbol: str, Hash: hashHex(s.Hash)}
+		m := randomMapping{s.Hash, 0}
+		for i := 0; i < nindices && m.lastIdx != math.MaxInt64; i++ {
+			vs.Indices = append(vs.Indices, m.lastIdx)
+			m.nextIndex()
+		}
+		v.Symbols = append(v.Symbols, vs)
+		enc.AddHashedSymbol(s)
+	}
+	for i := 0; i < ncoded; i++ {
+		c := enc.ProduceNextCodedSymbol()
+		str, err := symbolHex(c.Symbol)
+		if err != nil {
+			return v, err
+		}
+		v.CodedSymbols = append(v.CodedSymbols, TestVectorCodedSymbol{str, hashHex(c.Hash), c.Count})
+	}
+	return v, nil
+}
+
+// ParseTestVectorHash parses a hash in a TestVector.
+func ParseTestVectorHash(s string) (uint64, error) {
+	return strconv.ParseUint(s, 16, 64)
+}
+
+// symbolHex returns the hex encoding of the serialized form of t.
+func symbolHex[T any](t T) (string, error) {
+	m, ok := any(t).(encoding.BinaryMarshaler)
+	if !ok {
+		return "", ErrNotMarshalable
+	}
+	data, err := m.MarshalBinary()
+	return hex.EncodeToString(data), err
+}
+
+// hashHex returns the hash h as a 16-digit hex string.
+func hashHex(h uint64) string {
+	return fmt.Sprintf("%016x", h)
+}
@@ -0,0 +1,139 @@
+package riblt
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"os"
+	"reflect"
+	"testing"
+)
+
+var updateVectors = flag.Bool("update", false, "regenerate testdata/vectors.json")
+
+// vectorSymbol is the source symbol of the test vectors, an unsigned 64-bit
+// integer serialized in little endian.
+type vectorSymbol uint64
+
+func (v vectorSymbol) XOR(v2 vectorSymbol) vectorSymbol {
+	return v ^ v2
+}
+
+// Hash is not used by the test vectors, which give hashes explicitly.
+func (v vectorSymbol) Hash() uint64 {
+	return hashSymbol(v).Hash()
+}
+
+func (v vectorSymbol) MarshalBinary() ([]byte, error) {
+	return binary.LittleEndian.AppendUint64(nil, uint64(v)), nil
+}
+
+func (v *vectorSymbol) UnmarshalBinary(data []byte) error {
+	if len(data) != 8 {
+		return ErrMalformed
+	}
+	*v = vectorSymbol(binary.LittleEndian.Uint64(data))
+	return nil
+}
+
+// vectorSets returns the sets of source symbols that the test vectors are
+// generated for.
+func vectorSets() map[string][]HashedSymbol[vectorSymbol] {
+	sets := make(map[string][]HashedSymbol[vectorSymbol])
+	sets["single"] = []HashedSymbol[vectorSymbol]{{1, 0x0123456789abcdef}}
+	sets["edge-hashes"] = []HashedSymbol[vectorSymbol]{
+		{1, 0}, {2, 1}, {3, 0xffffffffffffffff}, {4, 0x8000000000000000},
+	}
+	var many []HashedSymbol[vectorSymbol]
+	for i := uint64(0); i < 100; i++ {
+		many = append(many, HashedSymbol[vectorSymbol]{vectorSymbol(i + 1), hashSymbol(i).Hash()})
+	}
+	sets["hundred"] = many
+	return sets
+}
+
+func TestVectors(t *testing.T) {
+	const path = "testdata/vectors.json"
+	if *updateVectors {
+		var vectors []TestVector
+		for _, name := range []string{"single", "edge-hashes", "hundred"} {
+			v, err := GenerateTestVector(name, vectorSets()[name], 20, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vectors = append(vectors, v)
+		}
+		data, err := json.MarshalIndent(vectors, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []TestVector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) == 0 {
+		t.Fatal("no test vectors")
+	}
+	for _, v := range vectors {
+		// regenerate the vector from the source symbols it lists
+		var set []HashedSymbol[vectorSymbol]
+		nindices := 0
+		for _, s := range v.Symbols {
+			nindices = max(nindices, len(s.Indices))
+			buf, err := hex.DecodeString(s.Symbol)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var sym vectorSymbol
+			if err := sym.UnmarshalBinary(buf); err != nil {
+				t.Fatal(err)
+			}
+			h, err := ParseTestVectorHash(s.Hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			set = append(set, HashedSymbol[vectorSymbol]{sym, h})
+		}
+		got, err := GenerateTestVector(v.Name, set, nindices, len(v.CodedSymbols))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Errorf("vector %s does not match", v.Name)
+		}
+
+		// check the vector against itself: each coded symbol is the sum of
+		// the source symbols whose listed indices contain it, up to the
+		// smallest last listed index of the sequences that do not end
+		// early
+		bound := uint64(len(v.CodedSymbols))
+		for _, s := range v.Symbols {
+			if last := s.Indices[len(s.Indices)-1]; len(s.Indices) == nindices && last < bound {
+				bound = last
+			}
+		}
+		for i := uint64(0); i <= bound && i < uint64(len(v.CodedSymbols)); i++ {
+			c := CodedSymbol[vectorSymbol]{}
+			for j, s := range v.Symbols {
+				for _, idx := range s.Indices {
+					if idx == i {
+						c = c.apply(set[j], add)
+					}
+				}
+			}
+			if exp := v.CodedSymbols[i]; exp.Count != c.Count || exp.Hash != hashHex(c.Hash) {
+				t.Errorf("vector %s: coded symbol %d is inconsistent with the listed indices", v.Name, i)
+			}
+		}
+	}
+}